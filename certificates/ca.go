@@ -0,0 +1,135 @@
+package certificates
+
+import (
+	"crypto/x509"
+	"fmt"
+	"time"
+
+	"github.com/gruyaume/goops"
+)
+
+const CASecretLabel = "certificates-ca"
+
+const (
+	DefaultCAValidity          = 10 * 365 * 24 * time.Hour
+	DefaultCertificateValidity = 365 * 24 * time.Hour
+)
+
+// CertificateAuthority is a self-signed root CA that signs the certificate
+// signing requests of the provider. The root certificate and its private key
+// are kept in an app owned secret, so only the leader can create the CA.
+type CertificateAuthority struct {
+	CommonName   string
+	Organization string
+	// KeyAlgorithm defaults to DefaultKeyAlgorithm.
+	KeyAlgorithm KeyAlgorithm
+	// CAValidity defaults to DefaultCAValidity.
+	CAValidity time.Duration
+	// CertificateValidity defaults to DefaultCertificateValidity. Issued
+	// certificates never outlive the CA.
+	CertificateValidity time.Duration
+	// KeyUsage and ExtKeyUsage apply to leaf certificates. They default to
+	// digital signature (plus key encipherment for RSA keys) and to server
+	// and client authentication.
+	KeyUsage    x509.KeyUsage
+	ExtKeyUsage []x509.ExtKeyUsage
+}
+
+// GetOrCreate returns the CA certificate and private key, creating them on
+// first use.
+func (ca *CertificateAuthority) GetOrCreate() (certPEM string, keyPEM string, err error) {
+	secret, _ := goops.GetSecretByLabel(CASecretLabel, false, true)
+	if secret != nil {
+		return secret["certificate"], secret["private-key"], nil
+	}
+
+	if ca.CommonName == "" {
+		return "", "", fmt.Errorf("CA common name is empty")
+	}
+
+	isLeader, err := goops.IsLeader()
+	if err != nil {
+		return "", "", fmt.Errorf("could not determine if unit is leader: %w", err)
+	}
+
+	if !isLeader {
+		return "", "", fmt.Errorf("unit is not the leader and cannot create the CA")
+	}
+
+	validity := ca.CAValidity
+	if validity == 0 {
+		validity = DefaultCAValidity
+	}
+
+	certPEM, keyPEM, err = GenerateCA(&GenerateCAOpts{
+		CommonName:       ca.CommonName,
+		Organization:     ca.Organization,
+		ValidityDuration: validity,
+		KeyAlgorithm:     ca.KeyAlgorithm,
+	})
+	if err != nil {
+		return "", "", err
+	}
+
+	_, err = goops.AddSecret(&goops.AddSecretOptions{
+		Owner: goops.OwnerApplication,
+		Label: CASecretLabel,
+		Content: map[string]string{
+			"certificate": certPEM,
+			"private-key": keyPEM,
+		},
+	})
+	if err != nil {
+		return "", "", fmt.Errorf("could not add CA secret: %w", err)
+	}
+
+	goops.LogInfof("Created CA %s", ca.CommonName)
+
+	return certPEM, keyPEM, nil
+}
+
+// Sign issues a certificate for the request. Requests for a CA certificate
+// get an intermediate CA that can only sign leaf certificates. The result can
+// be passed as is to SetRelationCertificates.
+func (ca *CertificateAuthority) Sign(request RequirerCertificateRequest) (*SetRelationCertificateOptions, error) {
+	caCertPEM, caKeyPEM, err := ca.GetOrCreate()
+	if err != nil {
+		return nil, fmt.Errorf("could not get CA: %w", err)
+	}
+
+	signer, err := NewLocalKeySigner([]string{caCertPEM}, caKeyPEM)
+	if err != nil {
+		return nil, err
+	}
+
+	signer.CertificateValidity = ca.CertificateValidity
+	signer.KeyUsage = ca.KeyUsage
+	signer.ExtKeyUsage = ca.ExtKeyUsage
+
+	return signer.Sign(request)
+}
+
+// SignOutstandingCertificateRequests signs every certificate signing request
+// that has no certificate yet and publishes the certificates. Requests for a
+// CA certificate are skipped, the intermediate CA could issue certificates for
+// any name. Charms approve them with a policy through
+// SignApprovedCertificateRequests instead.
+func (p *IntegrationProvider) SignOutstandingCertificateRequests(signer Signer) error {
+	status, err := p.GetCertificateRequestsStatus(RenewalPolicy{})
+	if err != nil {
+		return fmt.Errorf("could not get certificate requests status: %w", err)
+	}
+
+	requests := make([]RequirerCertificateRequest, 0, len(status.Outstanding))
+
+	for _, request := range status.Outstanding {
+		if request.IsCA {
+			goops.LogWarningf("Skipping request for a CA certificate for %s", request.CertificateSigningRequest.CommonName)
+			continue
+		}
+
+		requests = append(requests, request)
+	}
+
+	return p.IssueCertificates(signer, requests)
+}
@@ -0,0 +1,291 @@
+package certificates_test
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"testing"
+
+	"github.com/gruyaume/charm-libraries/certificates"
+	"github.com/gruyaume/goops/goopstest"
+)
+
+func SignOutstandingCertificateRequestsExampleUse() error {
+	ip := &certificates.IntegrationProvider{
+		RelationName: "certificates",
+	}
+
+	ca := &certificates.CertificateAuthority{
+		CommonName: "Example CA",
+	}
+
+	err := ip.SignOutstandingCertificateRequests(ca)
+	if err != nil {
+		return fmt.Errorf("failed to sign outstanding certificate requests: %w", err)
+	}
+
+	return nil
+}
+
+func parseCertificate(t *testing.T, certificatePEM string) *x509.Certificate {
+	t.Helper()
+
+	block, _ := pem.Decode([]byte(certificatePEM))
+	if block == nil {
+		t.Fatalf("failed to decode certificate")
+	}
+
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		t.Fatalf("failed to parse certificate: %v", err)
+	}
+
+	return cert
+}
+
+func TestSignOutstandingCertificateRequests(t *testing.T) {
+	ctx := goopstest.NewContext(
+		SignOutstandingCertificateRequestsExampleUse,
+		goopstest.WithUnitID("provider/0"),
+		goopstest.WithAppName("provider"),
+	)
+
+	privateKey, _ := generatePrivateKeyPEM(t)
+	serverCSR := generateCSRForKey(t, privateKey, "server.example.com")
+	intermediateCSR := generateCSRForKey(t, privateKey, "intermediate.example.com")
+
+	requestData, err := json.Marshal([]map[string]any{
+		{"certificate_signing_request": serverCSR, "ca": false},
+		{"certificate_signing_request": intermediateCSR, "ca": true},
+	})
+	if err != nil {
+		t.Fatalf("failed to marshal request data: %v", err)
+	}
+
+	stateIn := goopstest.State{
+		Leader: true,
+		Relations: []goopstest.Relation{
+			{
+				Endpoint:      "certificates",
+				RemoteAppName: "requirer",
+				RemoteUnitsData: map[goopstest.UnitID]goopstest.DataBag{
+					"requirer/0": {
+						"certificate_signing_requests": string(requestData),
+					},
+				},
+			},
+		},
+	}
+
+	stateOut := ctx.Run("start", stateIn)
+
+	if ctx.CharmErr != nil {
+		t.Fatalf("charm error: %v", ctx.CharmErr)
+	}
+
+	if len(stateOut.Secrets) != 1 || stateOut.Secrets[0].Label != certificates.CASecretLabel {
+		t.Fatalf("expected the CA secret to be created, got %v", stateOut.Secrets)
+	}
+
+	caCert := parseCertificate(t, stateOut.Secrets[0].Content["certificate"])
+	if !caCert.IsCA || caCert.Subject.CommonName != "Example CA" {
+		t.Fatalf("expected a CA certificate for 'Example CA', got %v", caCert.Subject)
+	}
+
+	roots := x509.NewCertPool()
+	roots.AddCert(caCert)
+
+	var certs []certificates.CertificateSigningRequestProviderAppRelationData
+
+	err = json.Unmarshal([]byte(stateOut.Relations[0].LocalAppData["certificates"]), &certs)
+	if err != nil {
+		t.Fatalf("failed to unmarshal relation data: %v", err)
+	}
+
+	if len(certs) != 1 || certs[0].CertificateSigningRequest != serverCSR {
+		t.Fatalf("expected only the server certificate, the CA request must be skipped")
+	}
+
+	cert := parseCertificate(t, certs[0].Certificate)
+
+	_, err = cert.Verify(x509.VerifyOptions{Roots: roots})
+	if err != nil {
+		t.Fatalf("certificate %s does not chain to the CA: %v", cert.Subject.CommonName, err)
+	}
+
+	if cert.IsCA {
+		t.Errorf("expected a leaf certificate for %s", cert.Subject.CommonName)
+	}
+
+	if len(certs[0].Chain) != 2 || certs[0].Chain[0] != certs[0].Certificate {
+		t.Errorf("expected chain to start with the certificate and end with the CA")
+	}
+}
+
+func TestCertificateAuthoritySignIntermediateCA(t *testing.T) {
+	privateKey, _ := generatePrivateKeyPEM(t)
+	intermediateCSR := generateCSRForKey(t, privateKey, "intermediate.example.com")
+
+	ctx := goopstest.NewContext(func() error {
+		ca := &certificates.CertificateAuthority{
+			CommonName: "Example CA",
+		}
+
+		opts, err := ca.Sign(certificates.RequirerCertificateRequest{
+			RelationID:                "certificates:0",
+			CertificateSigningRequest: certificates.CertificateSigningRequest{Raw: intermediateCSR},
+			IsCA:                      true,
+		})
+		if err != nil {
+			return err
+		}
+
+		cert := parseCertificate(t, opts.Certificate)
+		if !cert.IsCA || !cert.MaxPathLenZero {
+			return fmt.Errorf("expected an intermediate CA that only signs leaf certificates")
+		}
+
+		return nil
+	}, goopstest.WithUnitID("provider/0"), goopstest.WithAppName("provider"))
+
+	ctx.Run("start", goopstest.State{Leader: true})
+
+	if ctx.CharmErr != nil {
+		t.Fatalf("charm error: %v", ctx.CharmErr)
+	}
+}
+
+func TestSignOutstandingCertificateRequestsSkipsIssued(t *testing.T) {
+	ctx := goopstest.NewContext(
+		SignOutstandingCertificateRequestsExampleUse,
+		goopstest.WithUnitID("provider/0"),
+		goopstest.WithAppName("provider"),
+	)
+
+	privateKey, _ := generatePrivateKeyPEM(t)
+	issuedCSR := generateCSRForKey(t, privateKey, "issued.example.com")
+	newCSR := generateCSRForKey(t, privateKey, "new.example.com")
+
+	requestData, err := json.Marshal([]map[string]any{
+		{"certificate_signing_request": issuedCSR, "ca": false},
+		{"certificate_signing_request": newCSR, "ca": false},
+	})
+	if err != nil {
+		t.Fatalf("failed to marshal request data: %v", err)
+	}
+
+	issuedData, err := json.Marshal([]certificates.CertificateSigningRequestProviderAppRelationData{
+		{CA: "old-ca", Chain: []string{"old-cert", "old-ca"}, CertificateSigningRequest: issuedCSR, Certificate: "old-cert"},
+	})
+	if err != nil {
+		t.Fatalf("failed to marshal issued certificates: %v", err)
+	}
+
+	stateIn := goopstest.State{
+		Leader: true,
+		Relations: []goopstest.Relation{
+			{
+				Endpoint:      "certificates",
+				RemoteAppName: "requirer",
+				LocalAppData: goopstest.DataBag{
+					"certificates": string(issuedData),
+				},
+				RemoteUnitsData: map[goopstest.UnitID]goopstest.DataBag{
+					"requirer/0": {
+						"certificate_signing_requests": string(requestData),
+					},
+				},
+			},
+		},
+	}
+
+	stateOut := ctx.Run("start", stateIn)
+
+	if ctx.CharmErr != nil {
+		t.Fatalf("charm error: %v", ctx.CharmErr)
+	}
+
+	var certs []certificates.CertificateSigningRequestProviderAppRelationData
+
+	err = json.Unmarshal([]byte(stateOut.Relations[0].LocalAppData["certificates"]), &certs)
+	if err != nil {
+		t.Fatalf("failed to unmarshal relation data: %v", err)
+	}
+
+	if len(certs) != 2 {
+		t.Fatalf("expected 2 certificates, got %d", len(certs))
+	}
+
+	if certs[0].Certificate != "old-cert" {
+		t.Errorf("expected the issued certificate to be kept, got %q", certs[0].Certificate)
+	}
+
+	if certs[1].CertificateSigningRequest != newCSR {
+		t.Errorf("expected the new request to be signed")
+	}
+}
+
+func TestSignOutstandingCertificateRequestsKeepsRevoked(t *testing.T) {
+	ctx := goopstest.NewContext(
+		SignOutstandingCertificateRequestsExampleUse,
+		goopstest.WithUnitID("provider/0"),
+		goopstest.WithAppName("provider"),
+	)
+
+	privateKey, _ := generatePrivateKeyPEM(t)
+	revokedCSR := generateCSRForKey(t, privateKey, "revoked.example.com")
+
+	requestData, err := json.Marshal([]map[string]any{
+		{"certificate_signing_request": revokedCSR, "ca": false},
+	})
+	if err != nil {
+		t.Fatalf("failed to marshal request data: %v", err)
+	}
+
+	issuedData, err := json.Marshal([]certificates.CertificateV4{
+		{CA: "old-ca", Chain: []string{"old-cert", "old-ca"}, CertificateSigningRequest: revokedCSR, Certificate: "old-cert", Revoked: true},
+	})
+	if err != nil {
+		t.Fatalf("failed to marshal issued certificates: %v", err)
+	}
+
+	stateIn := goopstest.State{
+		Leader: true,
+		Relations: []goopstest.Relation{
+			{
+				Endpoint:      "certificates",
+				RemoteAppName: "requirer",
+				LocalAppData: goopstest.DataBag{
+					"certificates": string(issuedData),
+				},
+				RemoteUnitsData: map[goopstest.UnitID]goopstest.DataBag{
+					"requirer/0": {
+						"certificate_signing_requests": string(requestData),
+					},
+				},
+			},
+		},
+	}
+
+	stateOut := ctx.Run("start", stateIn)
+
+	if ctx.CharmErr != nil {
+		t.Fatalf("charm error: %v", ctx.CharmErr)
+	}
+
+	var certs []certificates.CertificateV4
+
+	err = json.Unmarshal([]byte(stateOut.Relations[0].LocalAppData["certificates"]), &certs)
+	if err != nil {
+		t.Fatalf("failed to unmarshal relation data: %v", err)
+	}
+
+	if len(certs) != 1 {
+		t.Fatalf("expected 1 certificate, got %d", len(certs))
+	}
+
+	if certs[0].Certificate != "old-cert" || !certs[0].Revoked {
+		t.Errorf("expected the revoked certificate to stay revoked, got %+v", certs[0])
+	}
+}
@@ -0,0 +1,465 @@
+package certificates
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"time"
+
+	"github.com/gruyaume/goops"
+)
+
+// CRLSecretLabel prefixes the labels of the app owned secrets holding the
+// revocation lists. Each issuer has its own, labelled with a fingerprint of
+// its public key.
+const CRLSecretLabel = "certificates-crl"
+
+// DefaultCRLNextUpdate is how long a CRL stays current when
+// GenerateCRLOptions.NextUpdate is not set.
+const DefaultCRLNextUpdate = 7 * 24 * time.Hour
+
+// crlKey is the provider app data key holding the CRL. It is not part of the
+// tls-certificates interface, requirers that do not know it ignore it.
+const crlKey = "crl"
+
+var (
+	ErrInvalidCRL = errors.New("invalid certificate revocation list")
+	ErrCRLExpired = errors.New("certificate revocation list is past its next update")
+)
+
+type RevokedCertificate struct {
+	// SerialNumber is in decimal, as reported by ParseCertificate.
+	SerialNumber   string    `json:"serial_number"`
+	RevocationTime time.Time `json:"revocation_time"`
+	// ReasonCode is one of the CRLReason values of RFC 5280, 0 when
+	// unspecified.
+	ReasonCode int `json:"reason_code,omitempty"`
+}
+
+type GenerateCRLOptions struct {
+	// NextUpdate defaults to DefaultCRLNextUpdate. The CRL must be
+	// generated and published again before it elapses.
+	NextUpdate time.Duration
+}
+
+// Revoker keeps the revocation list of an issuer and signs CRLs with its key,
+// wherever the key lives. CertificateAuthority, KeySigner and PKCS11Signer
+// implement it.
+type Revoker interface {
+	RevokeCertificate(certificatePEM string, reasonCode int) error
+	GetRevokedCertificates() ([]RevokedCertificate, error)
+	GenerateCRL(opts *GenerateCRLOptions) (string, error)
+}
+
+// crlState is the content of the app owned CRL secret of an issuer. CRL is
+// the last generated CRL.
+type crlState struct {
+	Revoked []RevokedCertificate
+	Number  int64
+	CRL     string
+}
+
+// RevokeCertificate adds a certificate issued by the CA to its revocation
+// list, kept in an app owned secret. Revoking a certificate twice keeps the
+// first revocation. Only the leader can revoke certificates. The relation data
+// is left untouched, charms also call IntegrationProvider.RevokeCertificates
+// so that requirers stop using the certificate.
+func (ca *CertificateAuthority) RevokeCertificate(certificatePEM string, reasonCode int) error {
+	caCert, err := ca.certificate()
+	if err != nil {
+		return err
+	}
+
+	return revokeCertificate(certificatePEM, caCert, reasonCode)
+}
+
+// RevokeCertificate adds a certificate issued by the signer to the revocation
+// list, as CertificateAuthority.RevokeCertificate does.
+func (s *KeySigner) RevokeCertificate(certificatePEM string, reasonCode int) error {
+	issuer, err := s.issuer()
+	if err != nil {
+		return err
+	}
+
+	return revokeCertificate(certificatePEM, issuer, reasonCode)
+}
+
+func revokeCertificate(certificatePEM string, caCert *x509.Certificate, reasonCode int) error {
+	cert, err := parseCertificatePEM(certificatePEM)
+	if err != nil {
+		return fmt.Errorf("could not parse certificate: %w", err)
+	}
+
+	err = cert.CheckSignatureFrom(caCert)
+	if err != nil {
+		return fmt.Errorf("certificate was not issued by the CA: %w", err)
+	}
+
+	state, err := loadCRLState(caCert)
+	if err != nil {
+		return err
+	}
+
+	serialNumber := cert.SerialNumber.String()
+
+	for _, revoked := range state.Revoked {
+		if revoked.SerialNumber == serialNumber {
+			return nil
+		}
+	}
+
+	state.Revoked = append(state.Revoked, RevokedCertificate{
+		SerialNumber:   serialNumber,
+		RevocationTime: time.Now().UTC().Truncate(time.Second),
+		ReasonCode:     reasonCode,
+	})
+
+	err = storeCRLState(caCert, state)
+	if err != nil {
+		return err
+	}
+
+	goops.LogInfof("Revoked certificate %s", serialNumber)
+
+	return nil
+}
+
+// GetRevokedCertificates returns the revocation list of the CA.
+func (ca *CertificateAuthority) GetRevokedCertificates() ([]RevokedCertificate, error) {
+	caCert, err := ca.certificate()
+	if err != nil {
+		return nil, err
+	}
+
+	return getRevokedCertificates(caCert)
+}
+
+// GetRevokedCertificates returns the revocation list of the signer.
+func (s *KeySigner) GetRevokedCertificates() ([]RevokedCertificate, error) {
+	issuer, err := s.issuer()
+	if err != nil {
+		return nil, err
+	}
+
+	return getRevokedCertificates(issuer)
+}
+
+func getRevokedCertificates(caCert *x509.Certificate) ([]RevokedCertificate, error) {
+	state, err := loadCRLState(caCert)
+	if err != nil {
+		return nil, err
+	}
+
+	return state.Revoked, nil
+}
+
+// certificate returns the parsed CA certificate.
+func (ca *CertificateAuthority) certificate() (*x509.Certificate, error) {
+	caCertPEM, _, err := ca.GetOrCreate()
+	if err != nil {
+		return nil, fmt.Errorf("could not get CA: %w", err)
+	}
+
+	caCert, err := parseCertificatePEM(caCertPEM)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse CA certificate: %w", err)
+	}
+
+	return caCert, nil
+}
+
+// GenerateCRL signs a CRL listing the revoked certificates with the CA key.
+// The last CRL is returned as is while it lists every revoked certificate and
+// less than half of its validity elapsed, so it can be called from any hook.
+// Each new CRL gets the next CRL number. Only the leader can generate CRLs.
+func (ca *CertificateAuthority) GenerateCRL(opts *GenerateCRLOptions) (string, error) {
+	caCertPEM, caKeyPEM, err := ca.GetOrCreate()
+	if err != nil {
+		return "", fmt.Errorf("could not get CA: %w", err)
+	}
+
+	caCert, err := parseCertificatePEM(caCertPEM)
+	if err != nil {
+		return "", fmt.Errorf("could not parse CA certificate: %w", err)
+	}
+
+	caKey, err := parsePrivateKeyPEM(caKeyPEM)
+	if err != nil {
+		return "", fmt.Errorf("could not parse CA private key: %w", err)
+	}
+
+	return generateCRL(caCert, caKey, opts)
+}
+
+// GenerateCRL signs a CRL with the signer key, as
+// CertificateAuthority.GenerateCRL does.
+func (s *KeySigner) GenerateCRL(opts *GenerateCRLOptions) (string, error) {
+	issuer, err := s.issuer()
+	if err != nil {
+		return "", err
+	}
+
+	return generateCRL(issuer, s.Key, opts)
+}
+
+func generateCRL(caCert *x509.Certificate, caKey crypto.Signer, opts *GenerateCRLOptions) (string, error) {
+	state, err := loadCRLState(caCert)
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+
+	if crlCurrent(state, caCert, now) {
+		return state.CRL, nil
+	}
+
+	nextUpdate := DefaultCRLNextUpdate
+	if opts != nil && opts.NextUpdate != 0 {
+		nextUpdate = opts.NextUpdate
+	}
+
+	entries := make([]x509.RevocationListEntry, 0, len(state.Revoked))
+
+	for _, revoked := range state.Revoked {
+		serialNumber, ok := new(big.Int).SetString(revoked.SerialNumber, 10)
+		if !ok {
+			return "", fmt.Errorf("invalid serial number %q in revocation list", revoked.SerialNumber)
+		}
+
+		entries = append(entries, x509.RevocationListEntry{
+			SerialNumber:   serialNumber,
+			RevocationTime: revoked.RevocationTime,
+			ReasonCode:     revoked.ReasonCode,
+		})
+	}
+
+	state.Number++
+
+	der, err := x509.CreateRevocationList(rand.Reader, &x509.RevocationList{
+		Number:                    big.NewInt(state.Number),
+		ThisUpdate:                now,
+		NextUpdate:                now.Add(nextUpdate),
+		RevokedCertificateEntries: entries,
+	}, caCert, caKey)
+	if err != nil {
+		return "", fmt.Errorf("could not create certificate revocation list: %w", err)
+	}
+
+	state.CRL = string(pem.EncodeToMemory(&pem.Block{Type: "X509 CRL", Bytes: der}))
+
+	err = storeCRLState(caCert, state)
+	if err != nil {
+		return "", err
+	}
+
+	return state.CRL, nil
+}
+
+// crlCurrent tells whether the last generated CRL can be published again. The
+// revocation list only grows, so a CRL with as many entries lists them all.
+func crlCurrent(state crlState, caCert *x509.Certificate, now time.Time) bool {
+	block, _ := pem.Decode([]byte(state.CRL))
+	if block == nil {
+		return false
+	}
+
+	crl, err := x509.ParseRevocationList(block.Bytes)
+	if err != nil || crl.CheckSignatureFrom(caCert) != nil {
+		return false
+	}
+
+	if len(crl.RevokedCertificateEntries) != len(state.Revoked) {
+		return false
+	}
+
+	halfway := crl.ThisUpdate.Add(crl.NextUpdate.Sub(crl.ThisUpdate) / 2)
+
+	return now.Before(halfway)
+}
+
+// PublishCRL writes the CRL in the app data bag of every relation, next to
+// the certificates, where GetCRL finds it.
+func (p *IntegrationProvider) PublishCRL(crlPEM string) error {
+	isLeader, err := goops.IsLeader()
+	if err != nil {
+		return fmt.Errorf("could not determine if unit is leader: %w", err)
+	}
+
+	if !isLeader {
+		return fmt.Errorf("unit is not the leader and cannot set app relation data")
+	}
+
+	relationIDs, err := goops.GetRelationIDs(p.RelationName)
+	if err != nil {
+		return fmt.Errorf("could not get relation IDs: %w", err)
+	}
+
+	for _, relationID := range relationIDs {
+		err = goops.SetAppRelationData(relationID, map[string]string{crlKey: crlPEM})
+		if err != nil {
+			return fmt.Errorf("could not set relation data: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// GetCRL returns the CRL published by the provider, or an empty string if it
+// publishes none.
+func (i *IntegrationRequirer) GetCRL() (string, error) {
+	relationID, err := i.GetRelationID()
+	if err != nil {
+		return "", fmt.Errorf("could not get relation ID: %w", err)
+	}
+
+	relationUnits, err := goops.ListRelationUnits(relationID)
+	if err != nil {
+		return "", fmt.Errorf("could not list relation units: %w", err)
+	}
+
+	if len(relationUnits) == 0 {
+		return "", nil
+	}
+
+	relationData, err := goops.GetAppRelationData(relationID, relationUnits[0])
+	if err != nil {
+		return "", fmt.Errorf("could not get relation data: %w", err)
+	}
+
+	return relationData[crlKey], nil
+}
+
+// IsCertificateRevoked tells whether the CRL lists the certificate. The CRL
+// must be signed by the CA and current, otherwise an error wrapping
+// ErrInvalidCRL or ErrCRLExpired is returned.
+func IsCertificateRevoked(certificatePEM string, crlPEM string, caPEM string) (bool, error) {
+	cert, err := parseCertificatePEM(certificatePEM)
+	if err != nil {
+		return false, fmt.Errorf("could not parse certificate: %w", err)
+	}
+
+	caCert, err := parseCertificatePEM(caPEM)
+	if err != nil {
+		return false, fmt.Errorf("could not parse CA certificate: %w", err)
+	}
+
+	block, _ := pem.Decode([]byte(crlPEM))
+	if block == nil || block.Type != "X509 CRL" {
+		return false, fmt.Errorf("%w: no PEM encoded CRL found", ErrInvalidCRL)
+	}
+
+	crl, err := x509.ParseRevocationList(block.Bytes)
+	if err != nil {
+		return false, fmt.Errorf("%w: %w", ErrInvalidCRL, err)
+	}
+
+	err = crl.CheckSignatureFrom(caCert)
+	if err != nil {
+		return false, fmt.Errorf("%w: %w", ErrInvalidCRL, err)
+	}
+
+	if !crl.NextUpdate.IsZero() && time.Now().After(crl.NextUpdate.Add(clockSkew)) {
+		return false, fmt.Errorf("%w: next update was %s", ErrCRLExpired, crl.NextUpdate.Format(time.RFC3339))
+	}
+
+	for _, entry := range crl.RevokedCertificateEntries {
+		if entry.SerialNumber.Cmp(cert.SerialNumber) == 0 {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// crlSecretLabel returns the label of the CRL secret of the issuer. Serial
+// numbers are only unique per issuer, so each one keeps its own list.
+func crlSecretLabel(caCert *x509.Certificate) string {
+	fingerprint := sha256.Sum256(caCert.RawSubjectPublicKeyInfo)
+
+	return CRLSecretLabel + "-" + hex.EncodeToString(fingerprint[:8])
+}
+
+func loadCRLState(caCert *x509.Certificate) (crlState, error) {
+	secret, _ := goops.GetSecretByLabel(crlSecretLabel(caCert), false, true)
+	if secret == nil {
+		return crlState{Revoked: make([]RevokedCertificate, 0)}, nil
+	}
+
+	state := crlState{Revoked: make([]RevokedCertificate, 0)}
+
+	if secret["revoked"] != "" {
+		err := json.Unmarshal([]byte(secret["revoked"]), &state.Revoked)
+		if err != nil {
+			return crlState{}, fmt.Errorf("could not unmarshal revoked certificates: %w", err)
+		}
+	}
+
+	if secret["number"] != "" {
+		number, err := strconv.ParseInt(secret["number"], 10, 64)
+		if err != nil {
+			return crlState{}, fmt.Errorf("could not parse CRL number: %w", err)
+		}
+
+		state.Number = number
+	}
+
+	state.CRL = secret["crl"]
+
+	return state, nil
+}
+
+func storeCRLState(caCert *x509.Certificate, state crlState) error {
+	isLeader, err := goops.IsLeader()
+	if err != nil {
+		return fmt.Errorf("could not determine if unit is leader: %w", err)
+	}
+
+	if !isLeader {
+		return fmt.Errorf("unit is not the leader and cannot update the revocation list")
+	}
+
+	revoked, err := json.Marshal(state.Revoked)
+	if err != nil {
+		return fmt.Errorf("could not marshal revoked certificates: %w", err)
+	}
+
+	content := map[string]string{
+		"revoked": string(revoked),
+		"number":  strconv.FormatInt(state.Number, 10),
+		"crl":     state.CRL,
+	}
+
+	label := crlSecretLabel(caCert)
+
+	secretInfo, err := goops.GetSecretInfoByLabel(label)
+	if err == nil {
+		for secretID := range secretInfo {
+			err = goops.SetSecret(&goops.SetSecretOptions{ID: secretID, Content: content})
+			if err != nil {
+				return fmt.Errorf("could not update CRL secret: %w", err)
+			}
+
+			return nil
+		}
+	}
+
+	_, err = goops.AddSecret(&goops.AddSecretOptions{
+		Owner:   goops.OwnerApplication,
+		Label:   label,
+		Content: content,
+	})
+	if err != nil {
+		return fmt.Errorf("could not add CRL secret: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,404 @@
+package certificates_test
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/gruyaume/charm-libraries/certificates"
+	"github.com/gruyaume/goops/goopstest"
+)
+
+func RevokeAndPublishCRLExampleUse(certificatePEM string) func() error {
+	return func() error {
+		ca := &certificates.CertificateAuthority{
+			CommonName: "Example CA",
+		}
+
+		err := ca.RevokeCertificate(certificatePEM, 1)
+		if err != nil {
+			return fmt.Errorf("failed to revoke certificate: %w", err)
+		}
+
+		crlPEM, err := ca.GenerateCRL(&certificates.GenerateCRLOptions{NextUpdate: time.Hour})
+		if err != nil {
+			return fmt.Errorf("failed to generate CRL: %w", err)
+		}
+
+		ip := &certificates.IntegrationProvider{
+			RelationName: "certificates",
+		}
+
+		err = ip.PublishCRL(crlPEM)
+		if err != nil {
+			return fmt.Errorf("failed to publish CRL: %w", err)
+		}
+
+		return nil
+	}
+}
+
+func GetCRLExampleUse(certificatePEM string, caPEM string, expectedRevoked bool) func() error {
+	return func() error {
+		integration := &certificates.IntegrationRequirer{
+			RelationName: "certificates",
+		}
+
+		crlPEM, err := integration.GetCRL()
+		if err != nil {
+			return fmt.Errorf("failed to get CRL: %w", err)
+		}
+
+		revoked, err := certificates.IsCertificateRevoked(certificatePEM, crlPEM, caPEM)
+		if err != nil {
+			return fmt.Errorf("failed to check revocation: %w", err)
+		}
+
+		if revoked != expectedRevoked {
+			return fmt.Errorf("expected revoked to be %t, got %t", expectedRevoked, revoked)
+		}
+
+		return nil
+	}
+}
+
+func signTestCertificate(t *testing.T, caPEM string, caKeyPEM string, commonName string) string {
+	t.Helper()
+
+	privateKey, _ := generatePrivateKeyPEM(t)
+
+	return signTestCSR(t, generateCSRForKey(t, privateKey, commonName), caPEM, caKeyPEM)
+}
+
+// crlSecret returns the CRL secret of the CA. The label carries a fingerprint
+// of the CA public key.
+func crlSecret(id string, caPEM string, number string) goopstest.Secret {
+	block, _ := pem.Decode([]byte(caPEM))
+
+	caCert, _ := x509.ParseCertificate(block.Bytes)
+	fingerprint := sha256.Sum256(caCert.RawSubjectPublicKeyInfo)
+
+	return goopstest.Secret{
+		ID:      id,
+		Label:   certificates.CRLSecretLabel + "-" + hex.EncodeToString(fingerprint[:8]),
+		Owner:   "app",
+		Content: map[string]string{"number": number},
+	}
+}
+
+func parseCRL(t *testing.T, crlPEM string) *x509.RevocationList {
+	t.Helper()
+
+	block, _ := pem.Decode([]byte(crlPEM))
+	if block == nil {
+		t.Fatalf("failed to decode CRL PEM")
+	}
+
+	crl, err := x509.ParseRevocationList(block.Bytes)
+	if err != nil {
+		t.Fatalf("failed to parse CRL: %v", err)
+	}
+
+	return crl
+}
+
+// publishCRL runs the provider side and returns the published CRL.
+func publishCRL(t *testing.T, caPEM string, caKeyPEM string, revokedPEM string) string {
+	t.Helper()
+
+	ctx := goopstest.NewContext(
+		RevokeAndPublishCRLExampleUse(revokedPEM),
+		goopstest.WithUnitID("provider/0"),
+		goopstest.WithAppName("provider"),
+	)
+
+	stateIn := goopstest.State{
+		Leader: true,
+		Relations: []goopstest.Relation{
+			{
+				Endpoint:      "certificates",
+				RemoteAppName: "requirer",
+			},
+		},
+		Secrets: []goopstest.Secret{
+			{
+				ID:      "ca-secret",
+				Label:   certificates.CASecretLabel,
+				Owner:   "app",
+				Content: map[string]string{"certificate": caPEM, "private-key": caKeyPEM},
+			},
+			crlSecret("crl-secret", caPEM, "4"),
+		},
+	}
+
+	stateOut := ctx.Run("update-status", stateIn)
+
+	if ctx.CharmErr != nil {
+		t.Fatalf("charm error: %v", ctx.CharmErr)
+	}
+
+	for _, secret := range stateOut.Secrets {
+		if secret.ID == "crl-secret" && secret.Content["number"] != "5" {
+			t.Errorf("expected CRL number 5, got %q", secret.Content["number"])
+		}
+	}
+
+	crlPEM := stateOut.Relations[0].LocalAppData["crl"]
+	if crlPEM == "" {
+		t.Fatalf("expected the CRL to be published")
+	}
+
+	return crlPEM
+}
+
+func TestPublishCRL(t *testing.T) {
+	caPEM, caKeyPEM := generateTestCA(t)
+	revokedPEM := signTestCertificate(t, caPEM, caKeyPEM, "revoked.example.com")
+	validPEM := signTestCertificate(t, caPEM, caKeyPEM, "valid.example.com")
+
+	crlPEM := publishCRL(t, caPEM, caKeyPEM, revokedPEM)
+
+	crl := parseCRL(t, crlPEM)
+	if crl.Number.Int64() != 5 {
+		t.Errorf("expected CRL number 5, got %d", crl.Number.Int64())
+	}
+
+	if len(crl.RevokedCertificateEntries) != 1 || crl.RevokedCertificateEntries[0].ReasonCode != 1 {
+		t.Fatalf("expected 1 revoked certificate with reason 1, got %v", crl.RevokedCertificateEntries)
+	}
+
+	if crl.NextUpdate.Sub(crl.ThisUpdate) != time.Hour {
+		t.Errorf("expected next update one hour after this update, got %s", crl.NextUpdate.Sub(crl.ThisUpdate))
+	}
+
+	for _, tc := range []struct {
+		name     string
+		cert     string
+		expected bool
+	}{
+		{"revoked", revokedPEM, true},
+		{"valid", validPEM, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := goopstest.NewContext(
+				GetCRLExampleUse(tc.cert, caPEM, tc.expected),
+			)
+
+			_ = ctx.Run("update-status", goopstest.State{
+				Relations: []goopstest.Relation{
+					{
+						Endpoint:      "certificates",
+						RemoteAppName: "provider",
+						RemoteAppData: goopstest.DataBag{"crl": crlPEM},
+						RemoteUnitsData: map[goopstest.UnitID]goopstest.DataBag{
+							"provider/0": {},
+						},
+					},
+				},
+			})
+
+			if ctx.CharmErr != nil {
+				t.Fatalf("charm error: %v", ctx.CharmErr)
+			}
+		})
+	}
+}
+
+func TestGenerateCRLReusesCurrentCRL(t *testing.T) {
+	caPEM, caKeyPEM := generateTestCA(t)
+	firstPEM := signTestCertificate(t, caPEM, caKeyPEM, "first.example.com")
+	secondPEM := signTestCertificate(t, caPEM, caKeyPEM, "second.example.com")
+
+	ctx := goopstest.NewContext(func() error {
+		ca := &certificates.CertificateAuthority{
+			CommonName: "Example CA",
+		}
+
+		err := ca.RevokeCertificate(firstPEM, 0)
+		if err != nil {
+			return fmt.Errorf("failed to revoke certificate: %w", err)
+		}
+
+		crlPEM, err := ca.GenerateCRL(nil)
+		if err != nil {
+			return fmt.Errorf("failed to generate CRL: %w", err)
+		}
+
+		againPEM, err := ca.GenerateCRL(nil)
+		if err != nil {
+			return fmt.Errorf("failed to generate CRL: %w", err)
+		}
+
+		if againPEM != crlPEM {
+			return fmt.Errorf("expected the current CRL to be reused")
+		}
+
+		err = ca.RevokeCertificate(secondPEM, 0)
+		if err != nil {
+			return fmt.Errorf("failed to revoke certificate: %w", err)
+		}
+
+		newPEM, err := ca.GenerateCRL(nil)
+		if err != nil {
+			return fmt.Errorf("failed to generate CRL: %w", err)
+		}
+
+		crl := parseCRL(t, newPEM)
+		if crl.Number.Int64() != parseCRL(t, crlPEM).Number.Int64()+1 || len(crl.RevokedCertificateEntries) != 2 {
+			return fmt.Errorf("expected a new CRL listing both certificates")
+		}
+
+		return nil
+	}, goopstest.WithUnitID("provider/0"), goopstest.WithAppName("provider"))
+
+	stateOut := ctx.Run("update-status", goopstest.State{
+		Leader: true,
+		Secrets: []goopstest.Secret{
+			{
+				ID:      "ca-secret",
+				Label:   certificates.CASecretLabel,
+				Owner:   "app",
+				Content: map[string]string{"certificate": caPEM, "private-key": caKeyPEM},
+			},
+			crlSecret("crl-secret", caPEM, "0"),
+		},
+	})
+
+	if ctx.CharmErr != nil {
+		t.Fatalf("charm error: %v", ctx.CharmErr)
+	}
+
+	for _, secret := range stateOut.Secrets {
+		if secret.ID == "crl-secret" && secret.Content["number"] != "2" {
+			t.Errorf("expected CRL number 2, got %q", secret.Content["number"])
+		}
+	}
+}
+
+func TestIsCertificateRevokedRejectsForeignCRL(t *testing.T) {
+	caPEM, caKeyPEM := generateTestCA(t)
+	otherCAPEM, _ := generateTestCA(t)
+	revokedPEM := signTestCertificate(t, caPEM, caKeyPEM, "revoked.example.com")
+
+	crlPEM := publishCRL(t, caPEM, caKeyPEM, revokedPEM)
+
+	_, err := certificates.IsCertificateRevoked(revokedPEM, crlPEM, otherCAPEM)
+	if !errors.Is(err, certificates.ErrInvalidCRL) {
+		t.Fatalf("expected ErrInvalidCRL, got %v", err)
+	}
+
+	_, err = certificates.IsCertificateRevoked(revokedPEM, "", caPEM)
+	if !errors.Is(err, certificates.ErrInvalidCRL) {
+		t.Fatalf("expected ErrInvalidCRL for an empty CRL, got %v", err)
+	}
+}
+
+func TestRevokeCertificateFromAnotherCA(t *testing.T) {
+	caPEM, caKeyPEM := generateTestCA(t)
+	otherCAPEM, otherCAKeyPEM := generateTestCA(t)
+	foreignPEM := signTestCertificate(t, otherCAPEM, otherCAKeyPEM, "foreign.example.com")
+
+	ctx := goopstest.NewContext(
+		RevokeAndPublishCRLExampleUse(foreignPEM),
+	)
+
+	_ = ctx.Run("update-status", goopstest.State{
+		Leader: true,
+		Secrets: []goopstest.Secret{
+			{
+				ID:      "ca-secret",
+				Label:   certificates.CASecretLabel,
+				Owner:   "app",
+				Content: map[string]string{"certificate": caPEM, "private-key": caKeyPEM},
+			},
+		},
+	})
+
+	if ctx.CharmErr == nil {
+		t.Fatalf("expected charm error when revoking a certificate of another CA")
+	}
+}
+
+// RevokersExampleUse revokes a certificate of the first CA through the
+// Revoker interface and checks that the second CA keeps its own list.
+func RevokersExampleUse(chains [2]string, keys [2]string, certificatePEM string) func() error {
+	return func() error {
+		revokers := make([]certificates.Revoker, 0, len(chains))
+
+		for i := range chains {
+			signer, err := certificates.NewLocalKeySigner([]string{chains[i]}, keys[i])
+			if err != nil {
+				return fmt.Errorf("failed to create signer: %w", err)
+			}
+
+			revokers = append(revokers, signer)
+		}
+
+		err := revokers[0].RevokeCertificate(certificatePEM, 0)
+		if err != nil {
+			return fmt.Errorf("failed to revoke certificate: %w", err)
+		}
+
+		for i, expected := range []int{1, 0} {
+			revoked, err := revokers[i].GetRevokedCertificates()
+			if err != nil {
+				return fmt.Errorf("failed to get revoked certificates: %w", err)
+			}
+
+			if len(revoked) != expected {
+				return fmt.Errorf("expected issuer %d to list %d revoked certificates, got %d", i, expected, len(revoked))
+			}
+
+			crlPEM, err := revokers[i].GenerateCRL(nil)
+			if err != nil {
+				return fmt.Errorf("failed to generate CRL: %w", err)
+			}
+
+			isRevoked, err := certificates.IsCertificateRevoked(certificatePEM, crlPEM, chains[i])
+			if err != nil {
+				return fmt.Errorf("failed to check revocation: %w", err)
+			}
+
+			if isRevoked != (expected == 1) {
+				return fmt.Errorf("expected revoked to be %t in the CRL of issuer %d", expected == 1, i)
+			}
+		}
+
+		return nil
+	}
+}
+
+func TestRevokersKeepSeparateLists(t *testing.T) {
+	caPEM, caKeyPEM := generateTestCA(t)
+	otherCAPEM, otherCAKeyPEM := generateTestCA(t)
+	revokedPEM := signTestCertificate(t, caPEM, caKeyPEM, "revoked.example.com")
+
+	ctx := goopstest.NewContext(
+		RevokersExampleUse([2]string{caPEM, otherCAPEM}, [2]string{caKeyPEM, otherCAKeyPEM}, revokedPEM),
+		goopstest.WithUnitID("provider/0"),
+		goopstest.WithAppName("provider"),
+	)
+
+	stateOut := ctx.Run("update-status", goopstest.State{
+		Leader: true,
+		Secrets: []goopstest.Secret{
+			crlSecret("crl-secret", caPEM, "0"),
+			crlSecret("other-crl-secret", otherCAPEM, "0"),
+		},
+	})
+
+	if ctx.CharmErr != nil {
+		t.Fatalf("charm error: %v", ctx.CharmErr)
+	}
+
+	for _, secret := range stateOut.Secrets {
+		if secret.Content["number"] != "1" {
+			t.Errorf("expected CRL number 1 in %s, got %q", secret.ID, secret.Content["number"])
+		}
+	}
+}
@@ -0,0 +1,227 @@
+package certificates
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+	"time"
+
+	"github.com/gruyaume/goops"
+)
+
+// snapshotStateKey prefixes the unit state key holding the snapshot the
+// events are computed against. The relation name is appended.
+const snapshotStateKey = "certificates-snapshot-"
+
+type CertificateEventType string
+
+const (
+	// EventCertificateAvailable reports a first certificate for a request.
+	EventCertificateAvailable CertificateEventType = "certificate-available"
+	// EventCertificateRenewed reports a certificate replacing another one.
+	EventCertificateRenewed CertificateEventType = "certificate-renewed"
+	// EventCertificateRevoked reports a certificate the provider revoked.
+	EventCertificateRevoked CertificateEventType = "certificate-revoked"
+	// EventCertificateExpiring reports a certificate that entered its
+	// renewal window, or the provider's expiry notification window.
+	EventCertificateExpiring CertificateEventType = "certificate-expiring"
+	// EventCertificateSigningRequestWithdrawn reports a certificate signing
+	// request that no longer answers any certificate request, because the
+	// request was removed or its attributes changed.
+	EventCertificateSigningRequestWithdrawn CertificateEventType = "certificate-signing-request-withdrawn"
+)
+
+type CertificateEvent struct {
+	Type CertificateEventType
+	// Name is the name of the certificate request.
+	Name        string
+	Certificate *ProviderCertificate
+}
+
+// certificateSnapshot is what the requirer knew about a certificate request
+// at the end of the previous hook.
+type certificateSnapshot struct {
+	CertificateSigningRequest string               `json:"certificate_signing_request"`
+	Certificate               *ProviderCertificate `json:"certificate,omitempty"`
+	Expiring                  bool                 `json:"expiring,omitempty"`
+}
+
+// GetCertificateEvents compares the certificates assigned to the certificate
+// requests with the snapshot stored in the unit state by the previous call,
+// returns the transitions and stores the new snapshot. Holistic charms call
+// it once per hook and act on the events, for example to reload the workload
+// only when a certificate changed.
+func (i *IntegrationRequirer) GetCertificateEvents() ([]CertificateEvent, error) {
+	previous, err := i.loadCertificateSnapshots()
+	if err != nil {
+		return nil, err
+	}
+
+	current, err := i.currentCertificateSnapshots()
+	if err != nil {
+		return nil, err
+	}
+
+	events := diffCertificateSnapshots(previous, current)
+
+	err = i.storeCertificateSnapshots(current)
+	if err != nil {
+		return nil, err
+	}
+
+	return events, nil
+}
+
+func (i *IntegrationRequirer) currentCertificateSnapshots() (map[string]certificateSnapshot, error) {
+	certificateRequests, err := i.certificateRequests()
+	if err != nil {
+		return nil, err
+	}
+
+	privateKey, err := i.GetPrivateKey()
+	if err != nil {
+		return nil, fmt.Errorf("could not get private key: %w", err)
+	}
+
+	privateKeys := []string{privateKey}
+
+	previousPrivateKey, err := i.getPreviousPrivateKey()
+	if err == nil && previousPrivateKey != "" {
+		privateKeys = append(privateKeys, previousPrivateKey)
+	}
+
+	providerCertificates, err := i.GetProviderCertificate()
+	if err != nil {
+		goops.LogDebugf("No provider certificates: %v", err)
+
+		providerCertificates = nil
+	}
+
+	snapshots := make(map[string]certificateSnapshot)
+	now := time.Now()
+
+	for _, certificateRequest := range certificateRequests {
+		var snapshot certificateSnapshot
+
+		for _, key := range privateKeys {
+			// Revoked certificates are kept to report the revocation.
+			snapshot.Certificate = findLatestCertificate(providerCertificates, certificateRequest, key, true)
+			if snapshot.Certificate != nil {
+				break
+			}
+		}
+
+		if snapshot.Certificate != nil {
+			snapshot.CertificateSigningRequest = snapshot.Certificate.CertificateSigningRequest
+			snapshot.Expiring = certificateExpiring(i.Renewal, snapshot.Certificate, now)
+		}
+
+		snapshots[certificateRequest.Name] = snapshot
+	}
+
+	return snapshots, nil
+}
+
+// certificateExpiring tells whether the certificate entered the renewal
+// window, or the expiry notification window the provider recommends.
+func certificateExpiring(renewal RenewalPolicy, providerCertificate *ProviderCertificate, now time.Time) bool {
+	cert, err := parseCertificatePEM(providerCertificate.Certificate)
+	if err != nil {
+		return false
+	}
+
+	if !now.Before(renewal.RenewalTime(cert.NotBefore, cert.NotAfter)) {
+		return true
+	}
+
+	if providerCertificate.RecommendedExpiryNotificationTime != nil {
+		notificationTime := cert.NotAfter.Add(-time.Duration(*providerCertificate.RecommendedExpiryNotificationTime) * time.Hour)
+		if !now.Before(notificationTime) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func diffCertificateSnapshots(previous map[string]certificateSnapshot, current map[string]certificateSnapshot) []CertificateEvent {
+	events := make([]CertificateEvent, 0)
+
+	for _, name := range slices.Sorted(maps.Keys(previous)) {
+		before := previous[name]
+		after, ok := current[name]
+		if before.Certificate == nil {
+			continue
+		}
+
+		if !ok || after.Certificate == nil {
+			events = append(events, CertificateEvent{
+				Type:        EventCertificateSigningRequestWithdrawn,
+				Name:        name,
+				Certificate: before.Certificate,
+			})
+		}
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(current)) {
+		after := current[name]
+		if after.Certificate == nil {
+			continue
+		}
+
+		before := previous[name]
+
+		if before.Certificate == nil || before.Certificate.Certificate != after.Certificate.Certificate {
+			eventType := EventCertificateAvailable
+			if before.Certificate != nil {
+				eventType = EventCertificateRenewed
+			}
+
+			events = append(events, CertificateEvent{Type: eventType, Name: name, Certificate: after.Certificate})
+
+			before = certificateSnapshot{}
+		}
+
+		if after.Certificate.Revoked && (before.Certificate == nil || !before.Certificate.Revoked) {
+			events = append(events, CertificateEvent{Type: EventCertificateRevoked, Name: name, Certificate: after.Certificate})
+		}
+
+		if after.Expiring && !before.Expiring {
+			events = append(events, CertificateEvent{Type: EventCertificateExpiring, Name: name, Certificate: after.Certificate})
+		}
+	}
+
+	return events
+}
+
+func (i *IntegrationRequirer) loadCertificateSnapshots() (map[string]certificateSnapshot, error) {
+	snapshots := make(map[string]certificateSnapshot)
+
+	value, err := goops.GetState(snapshotStateKey + i.RelationName)
+	if err != nil || value == "" {
+		return snapshots, nil
+	}
+
+	err = json.Unmarshal([]byte(value), &snapshots)
+	if err != nil {
+		goops.LogWarningf("Discarding unreadable certificate snapshot: %v", err)
+		return make(map[string]certificateSnapshot), nil
+	}
+
+	return snapshots, nil
+}
+
+func (i *IntegrationRequirer) storeCertificateSnapshots(snapshots map[string]certificateSnapshot) error {
+	value, err := json.Marshal(snapshots)
+	if err != nil {
+		return fmt.Errorf("could not marshal certificate snapshot: %w", err)
+	}
+
+	err = goops.SetState(snapshotStateKey+i.RelationName, string(value))
+	if err != nil {
+		return fmt.Errorf("could not store certificate snapshot: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,109 @@
+package certificates_test
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/gruyaume/charm-libraries/certificates"
+	"github.com/gruyaume/goops/goopstest"
+)
+
+func CertificateEventsExampleUse(expected []certificates.CertificateEventType, names ...string) func() error {
+	return func() error {
+		certificateRequests := make([]certificates.CertificateRequestAttributes, 0, len(names))
+		for _, name := range names {
+			certificateRequests = append(certificateRequests, certificates.CertificateRequestAttributes{
+				Name:       name,
+				CommonName: "server.example.com",
+				SansDNS:    []string{"server.example.com"},
+			})
+		}
+
+		integration := &certificates.IntegrationRequirer{
+			RelationName:        "certificates",
+			CertificateRequests: certificateRequests,
+		}
+
+		events, err := integration.GetCertificateEvents()
+		if err != nil {
+			return fmt.Errorf("failed to get certificate events: %w", err)
+		}
+
+		eventTypes := make([]certificates.CertificateEventType, 0, len(events))
+		for _, event := range events {
+			if event.Certificate == nil {
+				return fmt.Errorf("expected event %s to carry the certificate", event.Type)
+			}
+
+			eventTypes = append(eventTypes, event.Type)
+		}
+
+		if !slices.Equal(eventTypes, expected) {
+			return fmt.Errorf("expected events %v, got %v", expected, eventTypes)
+		}
+
+		return nil
+	}
+}
+
+func TestGetCertificateEvents(t *testing.T) {
+	privateKey, privateKeyPEM := generatePrivateKeyPEM(t)
+	csrPEM := generateCSRForKey(t, privateKey, "server.example.com")
+	certPEM, caPEM := signWithNewCA(t, csrPEM)
+
+	renewedCSRPEM := generateCSRForKey(t, privateKey, "server.example.com")
+	renewedCAPEM, renewedCAKeyPEM := generateTestCA(t)
+
+	// The renewed certificate expires last, so it is the assigned one.
+	renewedCertPEM, err := certificates.SignCertificateSigningRequest(renewedCSRPEM, renewedCAPEM, renewedCAKeyPEM, &certificates.SignCertificateSigningRequestOpts{
+		ValidityDuration: 2 * time.Hour,
+	})
+	if err != nil {
+		t.Fatalf("failed to sign certificate signing request: %v", err)
+	}
+
+	issued := certificates.ProviderCertificate{CA: caPEM, Chain: []string{certPEM, caPEM}, CertificateSigningRequest: csrPEM, Certificate: certPEM}
+	renewed := certificates.ProviderCertificate{CA: renewedCAPEM, Chain: []string{renewedCertPEM, renewedCAPEM}, CertificateSigningRequest: renewedCSRPEM, Certificate: renewedCertPEM}
+	notificationTime := 3
+	expiring := renewed
+	expiring.RecommendedExpiryNotificationTime = &notificationTime
+	revoked := expiring
+	revoked.Revoked = true
+
+	steps := []struct {
+		name                 string
+		requests             []string
+		csrs                 []string
+		providerCertificates []certificates.ProviderCertificate
+		expected             []certificates.CertificateEventType
+	}{
+		{"nothing issued", []string{"server"}, []string{csrPEM}, nil, []certificates.CertificateEventType{}},
+		{"issued", []string{"server"}, []string{csrPEM}, []certificates.ProviderCertificate{issued}, []certificates.CertificateEventType{certificates.EventCertificateAvailable}},
+		{"unchanged", []string{"server"}, []string{csrPEM}, []certificates.ProviderCertificate{issued}, []certificates.CertificateEventType{}},
+		{"renewed", []string{"server"}, []string{renewedCSRPEM}, []certificates.ProviderCertificate{issued, renewed}, []certificates.CertificateEventType{certificates.EventCertificateRenewed}},
+		{"expiring", []string{"server"}, []string{renewedCSRPEM}, []certificates.ProviderCertificate{expiring}, []certificates.CertificateEventType{certificates.EventCertificateExpiring}},
+		{"revoked", []string{"server"}, []string{renewedCSRPEM}, []certificates.ProviderCertificate{revoked}, []certificates.CertificateEventType{certificates.EventCertificateRevoked}},
+		{"withdrawn", []string{}, []string{}, []certificates.ProviderCertificate{revoked}, []certificates.CertificateEventType{certificates.EventCertificateSigningRequestWithdrawn}},
+	}
+
+	storedState := goopstest.StoredState{}
+
+	for _, step := range steps {
+		ctx := goopstest.NewContext(
+			CertificateEventsExampleUse(step.expected, step.requests...),
+		)
+
+		stateIn := validatedCertificateState(t, privateKeyPEM, step.csrs, step.providerCertificates)
+		stateIn.StoredState = storedState
+
+		stateOut := ctx.Run("update-status", stateIn)
+
+		if ctx.CharmErr != nil {
+			t.Fatalf("%s: charm error: %v", step.name, ctx.CharmErr)
+		}
+
+		storedState = stateOut.StoredState
+	}
+}
@@ -0,0 +1,134 @@
+package certificates
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/gruyaume/goops"
+)
+
+// CertificateRequestsStatus sorts the certificate requests of the requirers
+// against the certificates published by the provider.
+type CertificateRequestsStatus struct {
+	// Outstanding requests have no certificate yet.
+	Outstanding []RequirerCertificateRequest
+	// Fulfilled requests have a certificate outside its renewal window.
+	Fulfilled []FulfilledCertificateRequest
+	// Expiring requests have a certificate inside its renewal window, or
+	// inside the expiry notification window recommended with it.
+	Expiring []FulfilledCertificateRequest
+	// Revoked requests have a revoked certificate. They are not signed
+	// again, the requirer has to publish a new certificate signing request.
+	Revoked []FulfilledCertificateRequest
+	// Orphaned certificates answer a certificate signing request that no
+	// requirer publishes anymore.
+	Orphaned []OrphanedCertificate
+	// Failures are the certificate requests that could not be read, as
+	// returned by GetOutstandingCertificateRequests.
+	Failures []CertificateRequestFailure
+}
+
+type FulfilledCertificateRequest struct {
+	Request     RequirerCertificateRequest
+	Certificate *ProviderCertificate
+}
+
+type OrphanedCertificate struct {
+	RelationID  string
+	Certificate *ProviderCertificate
+}
+
+// GetCertificateRequestsStatus reads the certificate requests and the
+// published certificates of every relation once, and sorts them. The renewal
+// policy decides when a certificate counts as expiring; the zero value uses
+// DefaultRenewalLifetimeFraction. Certificates of a relation where a data bag
+// could not be decoded are never reported as orphaned, since the requests
+// they answer may be in that data bag.
+func (p *IntegrationProvider) GetCertificateRequestsStatus(renewal RenewalPolicy) (*CertificateRequestsStatus, error) {
+	if p.RelationName == "" {
+		return nil, fmt.Errorf("relation name is empty")
+	}
+
+	relationIDs, err := goops.GetRelationIDs(p.RelationName)
+	if err != nil {
+		return nil, fmt.Errorf("could not get relation IDs: %w", err)
+	}
+
+	status := &CertificateRequestsStatus{
+		Outstanding: make([]RequirerCertificateRequest, 0),
+		Fulfilled:   make([]FulfilledCertificateRequest, 0),
+		Expiring:    make([]FulfilledCertificateRequest, 0),
+		Revoked:     make([]FulfilledCertificateRequest, 0),
+		Orphaned:    make([]OrphanedCertificate, 0),
+		Failures:    make([]CertificateRequestFailure, 0),
+	}
+
+	now := time.Now()
+
+	for _, relationID := range relationIDs {
+		requests, failures, err := readRequirerCertificateRequests(relationID)
+		if err != nil {
+			return nil, err
+		}
+
+		appData, err := p.getProviderAppRelationData(relationID)
+		if err != nil {
+			return nil, fmt.Errorf("could not get provider app relation data: %w", err)
+		}
+
+		issued := make(map[string]*ProviderCertificate, len(appData))
+		for _, entry := range appData {
+			issued[entry.CertificateSigningRequest] = newProviderCertificate(entry)
+		}
+
+		requested := make(map[string]bool, len(requests)+len(failures))
+
+		for _, request := range requests {
+			requested[request.CertificateSigningRequest.Raw] = true
+
+			providerCertificate, ok := issued[request.CertificateSigningRequest.Raw]
+			if !ok {
+				status.Outstanding = append(status.Outstanding, request)
+				continue
+			}
+
+			fulfilled := FulfilledCertificateRequest{Request: request, Certificate: providerCertificate}
+
+			switch {
+			case providerCertificate.Revoked:
+				status.Revoked = append(status.Revoked, fulfilled)
+			case certificateExpiring(renewal, providerCertificate, now):
+				status.Expiring = append(status.Expiring, fulfilled)
+			default:
+				status.Fulfilled = append(status.Fulfilled, fulfilled)
+			}
+		}
+
+		unreadableDatabag := false
+
+		for _, failure := range failures {
+			if failure.CertificateSigningRequest == "" {
+				unreadableDatabag = true
+			}
+
+			requested[failure.CertificateSigningRequest] = true
+		}
+
+		status.Failures = append(status.Failures, failures...)
+
+		if unreadableDatabag {
+			continue
+		}
+
+		for _, entry := range appData {
+			if !requested[entry.CertificateSigningRequest] {
+				status.Orphaned = append(status.Orphaned, OrphanedCertificate{
+					RelationID:  relationID,
+					Certificate: issued[entry.CertificateSigningRequest],
+				})
+			}
+		}
+	}
+
+	return status, nil
+}
@@ -0,0 +1,170 @@
+package certificates_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/gruyaume/charm-libraries/certificates"
+	"github.com/gruyaume/goops/goopstest"
+)
+
+func GetCertificateRequestsStatusExampleUse(fulfilledCSR string, expiringCSR string, outstandingCSR string, orphanedCSR string) func() error {
+	return func() error {
+		ip := &certificates.IntegrationProvider{
+			RelationName: "certificates",
+		}
+
+		status, err := ip.GetCertificateRequestsStatus(certificates.RenewalPolicy{})
+		if err != nil {
+			return fmt.Errorf("failed to get certificate requests status: %w", err)
+		}
+
+		if len(status.Outstanding) != 1 || status.Outstanding[0].CertificateSigningRequest.Raw != outstandingCSR {
+			return fmt.Errorf("expected 1 outstanding request, got %v", status.Outstanding)
+		}
+
+		if len(status.Fulfilled) != 1 || status.Fulfilled[0].Certificate.CertificateSigningRequest != fulfilledCSR {
+			return fmt.Errorf("expected 1 fulfilled request, got %v", status.Fulfilled)
+		}
+
+		if len(status.Expiring) != 1 || status.Expiring[0].Request.CertificateSigningRequest.Raw != expiringCSR {
+			return fmt.Errorf("expected 1 expiring request, got %v", status.Expiring)
+		}
+
+		if len(status.Orphaned) != 1 || status.Orphaned[0].Certificate.CertificateSigningRequest != orphanedCSR {
+			return fmt.Errorf("expected 1 orphaned certificate, got %v", status.Orphaned)
+		}
+
+		if status.Orphaned[0].RelationID != "certificates:0" {
+			return fmt.Errorf("expected orphan in relation certificates:0, got %s", status.Orphaned[0].RelationID)
+		}
+
+		return nil
+	}
+}
+
+func TestGetCertificateRequestsStatus(t *testing.T) {
+	privateKey, _ := generatePrivateKeyPEM(t)
+	fulfilledCSR := generateCSRForKey(t, privateKey, "fulfilled.example.com")
+	expiringCSR := generateCSRForKey(t, privateKey, "expiring.example.com")
+	outstandingCSR := generateCSRForKey(t, privateKey, "outstanding.example.com")
+	orphanedCSR := generateCSRForKey(t, privateKey, "orphaned.example.com")
+
+	ctx := goopstest.NewContext(
+		GetCertificateRequestsStatusExampleUse(fulfilledCSR, expiringCSR, outstandingCSR, orphanedCSR),
+		goopstest.WithUnitID("provider/0"),
+		goopstest.WithAppName("provider"),
+	)
+
+	requestData, err := json.Marshal([]map[string]any{
+		{"certificate_signing_request": fulfilledCSR, "ca": false},
+		{"certificate_signing_request": expiringCSR, "ca": false},
+		{"certificate_signing_request": outstandingCSR, "ca": false},
+	})
+	if err != nil {
+		t.Fatalf("failed to marshal request data: %v", err)
+	}
+
+	fulfilledCert, fulfilledCA := signWithNewCA(t, fulfilledCSR)
+	expiringCert, expiringCA := signWithNewCA(t, expiringCSR)
+	orphanedCert, orphanedCA := signWithNewCA(t, orphanedCSR)
+	notificationHours := 2
+
+	issuedData, err := json.Marshal([]certificates.CertificateV4{
+		{CA: fulfilledCA, Chain: []string{fulfilledCert, fulfilledCA}, CertificateSigningRequest: fulfilledCSR, Certificate: fulfilledCert},
+		{CA: expiringCA, Chain: []string{expiringCert, expiringCA}, CertificateSigningRequest: expiringCSR, Certificate: expiringCert, RecommendedExpiryNotificationTime: &notificationHours},
+		{CA: orphanedCA, Chain: []string{orphanedCert, orphanedCA}, CertificateSigningRequest: orphanedCSR, Certificate: orphanedCert},
+	})
+	if err != nil {
+		t.Fatalf("failed to marshal issued certificates: %v", err)
+	}
+
+	stateIn := goopstest.State{
+		Leader: true,
+		Relations: []goopstest.Relation{
+			{
+				Endpoint:      "certificates",
+				RemoteAppName: "requirer",
+				LocalAppData: goopstest.DataBag{
+					"certificates": string(issuedData),
+				},
+				RemoteUnitsData: map[goopstest.UnitID]goopstest.DataBag{
+					"requirer/0": {
+						"certificate_signing_requests": string(requestData),
+					},
+				},
+			},
+		},
+	}
+
+	_ = ctx.Run("start", stateIn)
+
+	if ctx.CharmErr != nil {
+		t.Fatalf("charm error: %v", ctx.CharmErr)
+	}
+}
+
+func GetCertificateRequestsStatusUnreadableExampleUse() error {
+	ip := &certificates.IntegrationProvider{
+		RelationName: "certificates",
+	}
+
+	status, err := ip.GetCertificateRequestsStatus(certificates.RenewalPolicy{})
+	if err != nil {
+		return fmt.Errorf("failed to get certificate requests status: %w", err)
+	}
+
+	if len(status.Failures) != 1 {
+		return fmt.Errorf("expected 1 failure, got %d", len(status.Failures))
+	}
+
+	if len(status.Orphaned) != 0 {
+		return fmt.Errorf("expected no orphaned certificates, got %d", len(status.Orphaned))
+	}
+
+	return nil
+}
+
+func TestGetCertificateRequestsStatusUnreadableDatabag(t *testing.T) {
+	ctx := goopstest.NewContext(
+		GetCertificateRequestsStatusUnreadableExampleUse,
+		goopstest.WithUnitID("provider/0"),
+		goopstest.WithAppName("provider"),
+	)
+
+	privateKey, _ := generatePrivateKeyPEM(t)
+	csr := generateCSRForKey(t, privateKey, "server.example.com")
+	cert, ca := signWithNewCA(t, csr)
+
+	issuedData, err := json.Marshal([]certificates.CertificateV4{
+		{CA: ca, Chain: []string{cert, ca}, CertificateSigningRequest: csr, Certificate: cert},
+	})
+	if err != nil {
+		t.Fatalf("failed to marshal issued certificates: %v", err)
+	}
+
+	stateIn := goopstest.State{
+		Leader: true,
+		Relations: []goopstest.Relation{
+			{
+				Endpoint:      "certificates",
+				RemoteAppName: "requirer",
+				LocalAppData: goopstest.DataBag{
+					"certificates": string(issuedData),
+				},
+				RemoteUnitsData: map[goopstest.UnitID]goopstest.DataBag{
+					"requirer/0": {
+						"certificate_signing_requests": "{not json",
+					},
+				},
+			},
+		},
+	}
+
+	_ = ctx.Run("start", stateIn)
+
+	if ctx.CharmErr != nil {
+		t.Fatalf("charm error: %v", ctx.CharmErr)
+	}
+}
@@ -2,11 +2,17 @@ module github.com/gruyaume/charm-libraries/certificates
 
 go 1.24.0
 
-require github.com/gruyaume/goops v0.0.23
+require (
+	github.com/ThalesIgnite/crypto11 v1.2.5
+	github.com/canonical/pebble v1.22.2
+	github.com/gruyaume/goops v0.0.23
+)
 
 require (
-	github.com/canonical/pebble v1.22.2 // indirect
 	github.com/gorilla/websocket v1.5.1 // indirect
+	github.com/miekg/pkcs11 v1.1.1 // indirect
+	github.com/pkg/errors v0.9.1 // indirect
+	github.com/thales-e-security/pool v0.0.2 // indirect
 	golang.org/x/net v0.40.0 // indirect
 	golang.org/x/sys v0.33.0 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
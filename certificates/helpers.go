@@ -1,15 +1,17 @@
 package certificates
 
 import (
-	"bytes"
+	"crypto"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/x509"
 	"crypto/x509/pkix"
+	"encoding/asn1"
 	"encoding/pem"
 	"fmt"
 	"math/big"
 	"net"
+	"net/url"
 	"time"
 )
 
@@ -20,21 +22,62 @@ type GenerateCertificateOpts struct {
 	CountryName         string
 	StateOrProvinceName string
 	LocalityName        string
+	SANDNSNames         []string
 	SANIPAddresses      []net.IP
+	SANURIs             []*url.URL
+	SANEmailAddresses   []string
 	ValidityDuration    time.Duration
+	// KeyAlgorithm defaults to DefaultKeyAlgorithm.
+	KeyAlgorithm KeyAlgorithm
+	// KeyUsage and ExtKeyUsage default to the usages of a TLS server and
+	// client certificate.
+	KeyUsage    x509.KeyUsage
+	ExtKeyUsage []x509.ExtKeyUsage
+	// IssuerCertificate and IssuerPrivateKey sign the certificate. The
+	// certificate is self-signed when they are empty.
+	IssuerCertificate string
+	IssuerPrivateKey  string
+}
+
+type GenerateCAOpts struct {
+	CommonName          string
+	Organization        string
+	OrganizationalUnit  string
+	CountryName         string
+	StateOrProvinceName string
+	LocalityName        string
+	ValidityDuration    time.Duration
+	// KeyAlgorithm defaults to DefaultKeyAlgorithm.
+	KeyAlgorithm KeyAlgorithm
+	// MaxPathLen limits the number of intermediate CAs below this one. Zero
+	// leaves it unconstrained.
+	MaxPathLen int
+	// IssuerCertificate and IssuerPrivateKey sign an intermediate CA. A root
+	// CA is generated when they are empty.
+	IssuerCertificate string
+	IssuerPrivateKey  string
+}
+
+type SignCertificateSigningRequestOpts struct {
+	// ValidityDuration defaults to DefaultCertificateValidity.
+	ValidityDuration time.Duration
+	// IsCA issues an intermediate CA that can only sign leaf certificates.
+	IsCA bool
+	// KeyUsage and ExtKeyUsage apply to leaf certificates. They default to
+	// the usages of a TLS server and client certificate.
+	KeyUsage    x509.KeyUsage
+	ExtKeyUsage []x509.ExtKeyUsage
 }
 
 func GenerateCertificate(opts *GenerateCertificateOpts) (certPEM string, keyPEM string, err error) {
-	priv, err := rsa.GenerateKey(rand.Reader, 2048)
+	priv, err := generateKey(opts.KeyAlgorithm)
 	if err != nil {
-		return "", "", fmt.Errorf("failed to generate private key: %w", err)
+		return "", "", err
 	}
 
-	serialLimit := new(big.Int).Lsh(big.NewInt(1), 128)
-
-	serial, err := rand.Int(rand.Reader, serialLimit)
+	serial, err := newSerialNumber()
 	if err != nil {
-		return "", "", fmt.Errorf("failed to generate serial number: %w", err)
+		return "", "", err
 	}
 
 	template := x509.Certificate{
@@ -48,33 +91,267 @@ func GenerateCertificate(opts *GenerateCertificateOpts) (certPEM string, keyPEM
 			OrganizationalUnit: []string{opts.OrganizationalUnit},
 		},
 		NotBefore:             time.Now(),
-		NotAfter:              time.Now().Add(opts.ValidityDuration), // 1 year
-		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
-		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		NotAfter:              time.Now().Add(opts.ValidityDuration),
+		KeyUsage:              opts.KeyUsage,
+		ExtKeyUsage:           opts.ExtKeyUsage,
 		BasicConstraintsValid: true,
 		IsCA:                  false,
+		DNSNames:              opts.SANDNSNames,
 		IPAddresses:           opts.SANIPAddresses,
+		URIs:                  opts.SANURIs,
+		EmailAddresses:        opts.SANEmailAddresses,
+	}
+
+	setLeafKeyUsage(&template, priv.Public())
+
+	certPEM, err = createCertificate(&template, priv, opts.IssuerCertificate, opts.IssuerPrivateKey)
+	if err != nil {
+		return "", "", err
+	}
+
+	keyPEM, err = marshalPrivateKeyPEM(priv)
+	if err != nil {
+		return "", "", err
+	}
+
+	return certPEM, keyPEM, nil
+}
+
+// GenerateCA generates a root CA, or an intermediate CA when an issuer is
+// given.
+func GenerateCA(opts *GenerateCAOpts) (certPEM string, keyPEM string, err error) {
+	priv, err := generateKey(opts.KeyAlgorithm)
+	if err != nil {
+		return "", "", err
+	}
+
+	serial, err := newSerialNumber()
+	if err != nil {
+		return "", "", err
+	}
+
+	template := x509.Certificate{
+		SerialNumber: serial,
+		Subject: newSubject(
+			opts.CommonName,
+			opts.Organization,
+			opts.OrganizationalUnit,
+			opts.CountryName,
+			opts.StateOrProvinceName,
+			opts.LocalityName,
+		),
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().Add(opts.ValidityDuration),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLen:            opts.MaxPathLen,
+	}
+
+	certPEM, err = createCertificate(&template, priv, opts.IssuerCertificate, opts.IssuerPrivateKey)
+	if err != nil {
+		return "", "", err
+	}
+
+	keyPEM, err = marshalPrivateKeyPEM(priv)
+	if err != nil {
+		return "", "", err
+	}
+
+	return certPEM, keyPEM, nil
+}
+
+// SignCertificateSigningRequest issues a certificate for the CSR, signed by
+// the given CA. The subject and SANs are copied from the CSR and the
+// certificate never outlives the CA. The options may be nil.
+func SignCertificateSigningRequest(csrPEM string, caCertPEM string, caKeyPEM string, opts *SignCertificateSigningRequestOpts) (string, error) {
+	if opts == nil {
+		opts = &SignCertificateSigningRequestOpts{}
+	}
+
+	csr, err := parseCertificateSigningRequestPEM(csrPEM)
+	if err != nil {
+		return "", err
+	}
+
+	caCert, err := parseCertificatePEM(caCertPEM)
+	if err != nil {
+		return "", fmt.Errorf("could not parse CA certificate: %w", err)
+	}
+
+	caKey, err := parsePrivateKeyPEM(caKeyPEM)
+	if err != nil {
+		return "", fmt.Errorf("could not parse CA private key: %w", err)
+	}
+
+	return signCertificateSigningRequest(csr, caCert, caKey, opts)
+}
+
+// signCertificateSigningRequest signs the request with a CA key that may live
+// outside the process, for example in an HSM.
+func signCertificateSigningRequest(csr *x509.CertificateRequest, caCert *x509.Certificate, caKey crypto.Signer, opts *SignCertificateSigningRequestOpts) (string, error) {
+	serial, err := newSerialNumber()
+	if err != nil {
+		return "", err
+	}
+
+	validity := opts.ValidityDuration
+	if validity == 0 {
+		validity = DefaultCertificateValidity
+	}
+
+	now := time.Now()
+
+	notAfter := now.Add(validity)
+	if notAfter.After(caCert.NotAfter) {
+		notAfter = caCert.NotAfter
+	}
+
+	template := x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               csr.Subject,
+		NotBefore:             now,
+		NotAfter:              notAfter,
+		DNSNames:              csr.DNSNames,
+		IPAddresses:           csr.IPAddresses,
+		EmailAddresses:        csr.EmailAddresses,
+		URIs:                  csr.URIs,
+		BasicConstraintsValid: true,
+	}
+
+	if opts.IsCA {
+		template.IsCA = true
+		template.MaxPathLenZero = true
+		template.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature
+	} else {
+		template.KeyUsage = opts.KeyUsage
+		template.ExtKeyUsage = opts.ExtKeyUsage
+		setLeafKeyUsage(&template, csr.PublicKey)
 	}
 
-	derCert, err := x509.CreateCertificate(rand.Reader, &template, &template, &priv.PublicKey, priv)
+	// The standard library drops registered IDs, so the subject alternative
+	// name extension is rebuilt from the parsed names when there are any.
+	if sansOID, err := parseSubjectAltNameOIDs(csr.Extensions); err == nil && len(sansOID) > 0 {
+		oids := make([]asn1.ObjectIdentifier, 0, len(sansOID))
+
+		for _, oidStr := range sansOID {
+			oid, err := parseOID(oidStr)
+			if err != nil {
+				return "", err
+			}
+
+			oids = append(oids, oid)
+		}
+
+		sanExtension, err := marshalSubjectAltName(csr.DNSNames, csr.EmailAddresses, csr.IPAddresses, csr.URIs, oids)
+		if err != nil {
+			return "", err
+		}
+
+		template.ExtraExtensions = append(template.ExtraExtensions, sanExtension)
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, &template, caCert, csr.PublicKey, caKey)
 	if err != nil {
-		return "", "", fmt.Errorf("failed to create certificate: %w", err)
+		return "", fmt.Errorf("failed to sign certificate: %w", err)
 	}
 
-	certBuf := &bytes.Buffer{}
+	return encodeCertificatePEM(der), nil
+}
+
+// createCertificate signs the template with the issuer, or self-signs it
+// with priv when no issuer is given.
+func createCertificate(template *x509.Certificate, priv crypto.Signer, issuerCertPEM string, issuerKeyPEM string) (string, error) {
+	parent := template
+
+	var signer crypto.Signer = priv
+
+	if issuerCertPEM != "" || issuerKeyPEM != "" {
+		issuerCert, err := parseCertificatePEM(issuerCertPEM)
+		if err != nil {
+			return "", fmt.Errorf("could not parse issuer certificate: %w", err)
+		}
+
+		issuerKey, err := parsePrivateKeyPEM(issuerKeyPEM)
+		if err != nil {
+			return "", fmt.Errorf("could not parse issuer private key: %w", err)
+		}
+
+		if template.NotAfter.After(issuerCert.NotAfter) {
+			template.NotAfter = issuerCert.NotAfter
+		}
+
+		parent = issuerCert
+		signer = issuerKey
+	}
 
-	err = pem.Encode(certBuf, &pem.Block{Type: "CERTIFICATE", Bytes: derCert})
+	derCert, err := x509.CreateCertificate(rand.Reader, template, parent, priv.Public(), signer)
 	if err != nil {
-		return "", "", fmt.Errorf("failed to PEM‐encode certificate: %w", err)
+		return "", fmt.Errorf("failed to create certificate: %w", err)
 	}
 
-	keyBuf := &bytes.Buffer{}
-	privBytes := x509.MarshalPKCS1PrivateKey(priv)
+	return encodeCertificatePEM(derCert), nil
+}
+
+// setLeafKeyUsage fills in the default usages of a TLS certificate.
+func setLeafKeyUsage(template *x509.Certificate, publicKey crypto.PublicKey) {
+	if template.KeyUsage == 0 {
+		template.KeyUsage = keyUsageFor(publicKey)
+	}
+
+	if template.ExtKeyUsage == nil {
+		template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth}
+	}
+}
+
+// newSubject builds a subject, leaving out the empty attributes.
+func newSubject(commonName, organization, organizationalUnit, country, province, locality string) pkix.Name {
+	subject := pkix.Name{CommonName: commonName}
+
+	if organization != "" {
+		subject.Organization = []string{organization}
+	}
+
+	if organizationalUnit != "" {
+		subject.OrganizationalUnit = []string{organizationalUnit}
+	}
+
+	if country != "" {
+		subject.Country = []string{country}
+	}
+
+	if province != "" {
+		subject.Province = []string{province}
+	}
+
+	if locality != "" {
+		subject.Locality = []string{locality}
+	}
+
+	return subject
+}
+
+// keyUsageFor returns the key usages of a TLS certificate. Key encipherment
+// only applies to RSA keys, other key types only sign.
+func keyUsageFor(publicKey crypto.PublicKey) x509.KeyUsage {
+	if _, ok := publicKey.(*rsa.PublicKey); ok {
+		return x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment
+	}
 
-	err = pem.Encode(keyBuf, &pem.Block{Type: "RSA PRIVATE KEY", Bytes: privBytes})
+	return x509.KeyUsageDigitalSignature
+}
+
+func newSerialNumber() (*big.Int, error) {
+	serialLimit := new(big.Int).Lsh(big.NewInt(1), 128)
+
+	serial, err := rand.Int(rand.Reader, serialLimit)
 	if err != nil {
-		return "", "", fmt.Errorf("failed to PEM‐encode private key: %w", err)
+		return nil, fmt.Errorf("failed to generate serial number: %w", err)
 	}
 
-	return certBuf.String(), keyBuf.String(), nil
+	return serial, nil
+}
+
+func encodeCertificatePEM(der []byte) string {
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
 }
@@ -0,0 +1,144 @@
+package certificates_test
+
+import (
+	"crypto/x509"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/gruyaume/charm-libraries/certificates"
+)
+
+func TestGenerateCertificateChain(t *testing.T) {
+	rootPEM, rootKeyPEM, err := certificates.GenerateCA(&certificates.GenerateCAOpts{
+		CommonName:       "Root CA",
+		ValidityDuration: 24 * time.Hour,
+	})
+	if err != nil {
+		t.Fatalf("failed to generate root CA: %v", err)
+	}
+
+	intermediatePEM, intermediateKeyPEM, err := certificates.GenerateCA(&certificates.GenerateCAOpts{
+		CommonName:        "Intermediate CA",
+		ValidityDuration:  48 * time.Hour,
+		IssuerCertificate: rootPEM,
+		IssuerPrivateKey:  rootKeyPEM,
+	})
+	if err != nil {
+		t.Fatalf("failed to generate intermediate CA: %v", err)
+	}
+
+	spiffeID, err := url.Parse("spiffe://example.com/server")
+	if err != nil {
+		t.Fatalf("failed to parse URI: %v", err)
+	}
+
+	leafPEM, _, err := certificates.GenerateCertificate(&certificates.GenerateCertificateOpts{
+		CommonName:        "server.example.com",
+		SANDNSNames:       []string{"server.example.com"},
+		SANURIs:           []*url.URL{spiffeID},
+		SANEmailAddresses: []string{"admin@example.com"},
+		ValidityDuration:  time.Hour,
+		IssuerCertificate: intermediatePEM,
+		IssuerPrivateKey:  intermediateKeyPEM,
+	})
+	if err != nil {
+		t.Fatalf("failed to generate leaf certificate: %v", err)
+	}
+
+	root := parseCertificate(t, rootPEM)
+	intermediate := parseCertificate(t, intermediatePEM)
+	leaf := parseCertificate(t, leafPEM)
+
+	if !intermediate.NotAfter.Equal(root.NotAfter) {
+		t.Errorf("expected the intermediate CA to expire with the root CA")
+	}
+
+	roots := x509.NewCertPool()
+	roots.AddCert(root)
+
+	intermediates := x509.NewCertPool()
+	intermediates.AddCert(intermediate)
+
+	_, err = leaf.Verify(x509.VerifyOptions{
+		DNSName:       "server.example.com",
+		Roots:         roots,
+		Intermediates: intermediates,
+	})
+	if err != nil {
+		t.Fatalf("failed to verify leaf certificate: %v", err)
+	}
+
+	if len(leaf.URIs) != 1 || leaf.URIs[0].String() != "spiffe://example.com/server" {
+		t.Errorf("expected URI SAN spiffe://example.com/server, got %v", leaf.URIs)
+	}
+
+	if len(leaf.EmailAddresses) != 1 || leaf.EmailAddresses[0] != "admin@example.com" {
+		t.Errorf("expected email SAN admin@example.com, got %v", leaf.EmailAddresses)
+	}
+}
+
+func TestSignCertificateSigningRequest(t *testing.T) {
+	caPEM, caKeyPEM, err := certificates.GenerateCA(&certificates.GenerateCAOpts{
+		CommonName:       "Example CA",
+		ValidityDuration: 24 * time.Hour,
+	})
+	if err != nil {
+		t.Fatalf("failed to generate CA: %v", err)
+	}
+
+	privateKey, _ := generatePrivateKeyPEM(t)
+	csrPEM := generateCSRForKey(t, privateKey, "client.example.com")
+
+	certPEM, err := certificates.SignCertificateSigningRequest(csrPEM, caPEM, caKeyPEM, &certificates.SignCertificateSigningRequestOpts{
+		ValidityDuration: time.Hour,
+		ExtKeyUsage:      []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})
+	if err != nil {
+		t.Fatalf("failed to sign certificate signing request: %v", err)
+	}
+
+	cert := parseCertificate(t, certPEM)
+
+	if cert.Subject.CommonName != "client.example.com" {
+		t.Errorf("expected common name client.example.com, got %s", cert.Subject.CommonName)
+	}
+
+	if len(cert.ExtKeyUsage) != 1 || cert.ExtKeyUsage[0] != x509.ExtKeyUsageClientAuth {
+		t.Errorf("expected client auth usage only, got %v", cert.ExtKeyUsage)
+	}
+
+	if !privateKey.PublicKey.Equal(cert.PublicKey) {
+		t.Error("expected the certificate to carry the CSR public key")
+	}
+
+	err = cert.CheckSignatureFrom(parseCertificate(t, caPEM))
+	if err != nil {
+		t.Errorf("expected the certificate to be signed by the CA: %v", err)
+	}
+}
+
+func TestSignCertificateSigningRequestDefaultValidity(t *testing.T) {
+	caPEM, caKeyPEM, err := certificates.GenerateCA(&certificates.GenerateCAOpts{
+		CommonName:       "Example CA",
+		ValidityDuration: 10 * certificates.DefaultCertificateValidity,
+	})
+	if err != nil {
+		t.Fatalf("failed to generate CA: %v", err)
+	}
+
+	privateKey, _ := generatePrivateKeyPEM(t)
+	csrPEM := generateCSRForKey(t, privateKey, "client.example.com")
+
+	certPEM, err := certificates.SignCertificateSigningRequest(csrPEM, caPEM, caKeyPEM, nil)
+	if err != nil {
+		t.Fatalf("failed to sign certificate signing request: %v", err)
+	}
+
+	cert := parseCertificate(t, certPEM)
+
+	validity := cert.NotAfter.Sub(cert.NotBefore)
+	if validity < certificates.DefaultCertificateValidity-time.Minute || validity > certificates.DefaultCertificateValidity {
+		t.Errorf("expected the default validity, got %s", validity)
+	}
+}
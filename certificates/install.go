@@ -0,0 +1,136 @@
+package certificates
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/canonical/pebble/client"
+	"github.com/gruyaume/goops"
+)
+
+const (
+	defaultCertificatePermissions os.FileMode = 0o644
+	defaultPrivateKeyPermissions  os.FileMode = 0o600
+)
+
+// InstallCertificateOptions describes where an assigned certificate goes in a
+// workload container. CAPath is optional, the other paths are required.
+type InstallCertificateOptions struct {
+	ContainerName   string
+	CertificatePath string
+	PrivateKeyPath  string
+	CAPath          string
+	// User and Group own the files. They default to the Pebble defaults.
+	User  string
+	Group string
+	// CertificatePermissions applies to the certificate and the CA and
+	// defaults to 0644. PrivateKeyPermissions defaults to 0600.
+	CertificatePermissions os.FileMode
+	PrivateKeyPermissions  os.FileMode
+	// RestartServices are restarted when any of the files changed.
+	RestartServices []string
+}
+
+// InstallCertificate pushes the certificate assigned to the named request,
+// its private key and its CA into the workload container. Files are only
+// written when their content changed. The returned flag tells whether any
+// file changed, so the charm knows whether the workload must reload them.
+func (i *IntegrationRequirer) InstallCertificate(name string, opts *InstallCertificateOptions) (bool, error) {
+	if opts.ContainerName == "" || opts.CertificatePath == "" || opts.PrivateKeyPath == "" {
+		return false, fmt.Errorf("container name, certificate path and private key path are required")
+	}
+
+	providerCertificate, err := i.GetAssignedCertificate(name)
+	if err != nil {
+		return false, fmt.Errorf("could not get assigned certificate: %w", err)
+	}
+
+	privateKey, err := i.GetPrivateKeyForCertificate(providerCertificate)
+	if err != nil {
+		return false, fmt.Errorf("could not get private key: %w", err)
+	}
+
+	certificatePermissions := opts.CertificatePermissions
+	if certificatePermissions == 0 {
+		certificatePermissions = defaultCertificatePermissions
+	}
+
+	privateKeyPermissions := opts.PrivateKeyPermissions
+	if privateKeyPermissions == 0 {
+		privateKeyPermissions = defaultPrivateKeyPermissions
+	}
+
+	files := []containerFile{
+		{Path: opts.CertificatePath, Content: providerCertificate.Certificate, Permissions: certificatePermissions},
+		{Path: opts.PrivateKeyPath, Content: privateKey, Permissions: privateKeyPermissions},
+	}
+
+	if opts.CAPath != "" {
+		files = append(files, containerFile{Path: opts.CAPath, Content: providerCertificate.CA, Permissions: certificatePermissions})
+	}
+
+	pebble := goops.Pebble(opts.ContainerName)
+
+	changed := false
+
+	for _, file := range files {
+		file.User = opts.User
+		file.Group = opts.Group
+
+		fileChanged, err := pushFileIfChanged(pebble, file)
+		if err != nil {
+			return false, err
+		}
+
+		changed = changed || fileChanged
+	}
+
+	if changed && len(opts.RestartServices) > 0 {
+		_, err = pebble.Restart(&client.ServiceOptions{Names: opts.RestartServices})
+		if err != nil {
+			return true, fmt.Errorf("could not restart services: %w", err)
+		}
+	}
+
+	return changed, nil
+}
+
+type containerFile struct {
+	Path        string
+	Content     string
+	Permissions os.FileMode
+	User        string
+	Group       string
+}
+
+// pushFileIfChanged writes the file in the container unless it already holds
+// the same content. A file that cannot be pulled is written.
+func pushFileIfChanged(pebble goops.PebbleClient, file containerFile) (bool, error) {
+	current := &bytes.Buffer{}
+
+	err := pebble.Pull(&client.PullOptions{
+		Path:   file.Path,
+		Target: current,
+	})
+	if err == nil && current.String() == file.Content {
+		return false, nil
+	}
+
+	err = pebble.Push(&client.PushOptions{
+		Source:      strings.NewReader(file.Content),
+		Path:        file.Path,
+		MakeDirs:    true,
+		Permissions: file.Permissions.Perm(),
+		User:        file.User,
+		Group:       file.Group,
+	})
+	if err != nil {
+		return false, fmt.Errorf("could not push %s: %w", file.Path, err)
+	}
+
+	goops.LogDebugf("Pushed %s", file.Path)
+
+	return true, nil
+}
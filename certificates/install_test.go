@@ -0,0 +1,180 @@
+package certificates_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gruyaume/charm-libraries/certificates"
+	"github.com/gruyaume/goops/goopstest"
+)
+
+func installCertificate() (bool, error) {
+	integration := &certificates.IntegrationRequirer{
+		RelationName: "certificates",
+		CertificateRequests: []certificates.CertificateRequestAttributes{
+			{
+				Name:       "server",
+				CommonName: "server.example.com",
+				SansDNS:    []string{"server.example.com"},
+			},
+		},
+	}
+
+	return integration.InstallCertificate("server", &certificates.InstallCertificateOptions{
+		ContainerName:   "workload",
+		CertificatePath: "/etc/tls/server.crt",
+		PrivateKeyPath:  "/etc/tls/server.key",
+		CAPath:          "/etc/tls/ca.crt",
+	})
+}
+
+func InstallCertificateExampleUse() error {
+	changed, err := installCertificate()
+	if err != nil {
+		return fmt.Errorf("failed to install certificate: %w", err)
+	}
+
+	if !changed {
+		return fmt.Errorf("expected files to change")
+	}
+
+	return nil
+}
+
+func InstallUnchangedCertificateExampleUse() error {
+	changed, err := installCertificate()
+	if err != nil {
+		return fmt.Errorf("failed to install certificate: %w", err)
+	}
+
+	if changed {
+		return fmt.Errorf("expected files to be unchanged")
+	}
+
+	return nil
+}
+
+func installCertificateState(t *testing.T, privateKeyPEM string, serverCSR string, source string) goopstest.State {
+	t.Helper()
+
+	csrs, err := json.Marshal([]map[string]string{
+		{"certificate_signing_request": serverCSR, "ca": "false"},
+	})
+	if err != nil {
+		t.Fatalf("failed to marshal certificate signing requests: %v", err)
+	}
+
+	providerCertificates, err := json.Marshal([]certificates.ProviderCertificate{
+		{CA: "test-ca", Chain: []string{"server-cert", "test-ca"}, CertificateSigningRequest: serverCSR, Certificate: "server-cert"},
+	})
+	if err != nil {
+		t.Fatalf("failed to marshal provider certificates: %v", err)
+	}
+
+	return goopstest.State{
+		Relations: []goopstest.Relation{
+			{
+				Endpoint:      "certificates",
+				RemoteAppName: "provider",
+				LocalUnitData: goopstest.DataBag{
+					"certificate_signing_requests": string(csrs),
+				},
+				RemoteAppData: goopstest.DataBag{
+					"certificates": string(providerCertificates),
+				},
+				RemoteUnitsData: map[goopstest.UnitID]goopstest.DataBag{
+					"provider/0": {},
+				},
+			},
+		},
+		Secrets: []goopstest.Secret{
+			{
+				ID:      "private-key-secret",
+				Label:   certificates.PrivateKeySecretLabel,
+				Owner:   "unit",
+				Content: map[string]string{"private-key": privateKeyPEM},
+			},
+		},
+		Containers: []goopstest.Container{
+			{
+				Name:       "workload",
+				CanConnect: true,
+				Mounts: map[string]goopstest.Mount{
+					"certificate": {Location: "/etc/tls/server.crt", Source: source},
+					"private-key": {Location: "/etc/tls/server.key", Source: source},
+					"ca":          {Location: "/etc/tls/ca.crt", Source: source},
+				},
+			},
+		},
+	}
+}
+
+func TestInstallCertificate(t *testing.T) {
+	ctx := goopstest.NewContext(
+		InstallCertificateExampleUse,
+	)
+
+	privateKey, privateKeyPEM := generatePrivateKeyPEM(t)
+	serverCSR := generateCSRForKey(t, privateKey, "server.example.com")
+	source := t.TempDir()
+
+	_ = ctx.Run("start", installCertificateState(t, privateKeyPEM, serverCSR, source))
+
+	if ctx.CharmErr != nil {
+		t.Fatalf("charm error: %v", ctx.CharmErr)
+	}
+
+	expectedFiles := map[string]string{
+		"etc/tls/server.crt": "server-cert",
+		"etc/tls/server.key": privateKeyPEM,
+		"etc/tls/ca.crt":     "test-ca",
+	}
+
+	for path, expected := range expectedFiles {
+		content, err := os.ReadFile(filepath.Join(source, path))
+		if err != nil {
+			t.Fatalf("failed to read %s: %v", path, err)
+		}
+
+		if string(content) != expected {
+			t.Errorf("expected %s to contain %q, got %q", path, expected, string(content))
+		}
+	}
+}
+
+func TestInstallCertificateUnchanged(t *testing.T) {
+	ctx := goopstest.NewContext(
+		InstallUnchangedCertificateExampleUse,
+	)
+
+	privateKey, privateKeyPEM := generatePrivateKeyPEM(t)
+	serverCSR := generateCSRForKey(t, privateKey, "server.example.com")
+	source := t.TempDir()
+
+	existingFiles := map[string]string{
+		"etc/tls/server.crt": "server-cert",
+		"etc/tls/server.key": privateKeyPEM,
+		"etc/tls/ca.crt":     "test-ca",
+	}
+
+	for path, content := range existingFiles {
+		err := os.MkdirAll(filepath.Dir(filepath.Join(source, path)), 0o755)
+		if err != nil {
+			t.Fatalf("failed to create directory: %v", err)
+		}
+
+		err = os.WriteFile(filepath.Join(source, path), []byte(content), 0o600)
+		if err != nil {
+			t.Fatalf("failed to write %s: %v", path, err)
+		}
+	}
+
+	_ = ctx.Run("start", installCertificateState(t, privateKeyPEM, serverCSR, source))
+
+	if ctx.CharmErr != nil {
+		t.Fatalf("charm error: %v", ctx.CharmErr)
+	}
+}
@@ -0,0 +1,151 @@
+package certificates
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"strings"
+)
+
+// KeyAlgorithm is the type and size of a generated private key.
+type KeyAlgorithm string
+
+const (
+	KeyAlgorithmRSA2048   KeyAlgorithm = "rsa-2048"
+	KeyAlgorithmRSA3072   KeyAlgorithm = "rsa-3072"
+	KeyAlgorithmRSA4096   KeyAlgorithm = "rsa-4096"
+	KeyAlgorithmECDSAP256 KeyAlgorithm = "ecdsa-p256"
+	KeyAlgorithmECDSAP384 KeyAlgorithm = "ecdsa-p384"
+	KeyAlgorithmEd25519   KeyAlgorithm = "ed25519"
+
+	// DefaultKeyAlgorithm is used when no key algorithm is set.
+	DefaultKeyAlgorithm = KeyAlgorithmRSA2048
+)
+
+// GeneratePrivateKey generates a private key and returns it PEM encoded in
+// PKCS #8 form.
+func GeneratePrivateKey(algorithm KeyAlgorithm) (string, error) {
+	key, err := generateKey(algorithm)
+	if err != nil {
+		return "", err
+	}
+
+	return marshalPrivateKeyPEM(key)
+}
+
+func generateKey(algorithm KeyAlgorithm) (crypto.Signer, error) {
+	var (
+		key crypto.Signer
+		err error
+	)
+
+	switch algorithm {
+	case "", KeyAlgorithmRSA2048:
+		key, err = rsa.GenerateKey(rand.Reader, 2048)
+	case KeyAlgorithmRSA3072:
+		key, err = rsa.GenerateKey(rand.Reader, 3072)
+	case KeyAlgorithmRSA4096:
+		key, err = rsa.GenerateKey(rand.Reader, 4096)
+	case KeyAlgorithmECDSAP256:
+		key, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case KeyAlgorithmECDSAP384:
+		key, err = ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	case KeyAlgorithmEd25519:
+		_, key, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		return nil, fmt.Errorf("unsupported key algorithm %q", algorithm)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate private key: %w", err)
+	}
+
+	return key, nil
+}
+
+func marshalPrivateKeyPEM(key crypto.Signer) (string, error) {
+	privBytes, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal private key: %w", err)
+	}
+
+	keyBuf := &bytes.Buffer{}
+
+	err = pem.Encode(keyBuf, &pem.Block{Type: "PRIVATE KEY", Bytes: privBytes})
+	if err != nil {
+		return "", fmt.Errorf("failed to PEM‐encode private key: %w", err)
+	}
+
+	return keyBuf.String(), nil
+}
+
+// parsePrivateKeyPEM loads PKCS #8 keys as well as the PKCS #1 RSA keys and
+// SEC 1 EC keys generated before PKCS #8 was used.
+func parsePrivateKeyPEM(privateKeyPEM string) (crypto.Signer, error) {
+	block, _ := pem.Decode([]byte(privateKeyPEM))
+	if block == nil {
+		return nil, fmt.Errorf("failed to PEM decode private key")
+	}
+
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		key, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("could not parse private key: %w", err)
+		}
+
+		return key, nil
+	case "EC PRIVATE KEY":
+		key, err := x509.ParseECPrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("could not parse private key: %w", err)
+		}
+
+		return key, nil
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse private key: %w", err)
+	}
+
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("unsupported private key type %T", key)
+	}
+
+	return signer, nil
+}
+
+// publicKeysEqual reports whether both public keys are the same. All the key
+// types of crypto/x509 implement Equal.
+func publicKeysEqual(a crypto.PublicKey, b crypto.PublicKey) bool {
+	key, ok := a.(interface{ Equal(crypto.PublicKey) bool })
+	if !ok {
+		return false
+	}
+
+	return key.Equal(b)
+}
+
+// keyAlgorithmOf describes a public key with the KeyAlgorithm naming, also
+// for sizes and curves the library does not generate.
+func keyAlgorithmOf(publicKey crypto.PublicKey) KeyAlgorithm {
+	switch key := publicKey.(type) {
+	case *rsa.PublicKey:
+		return KeyAlgorithm(fmt.Sprintf("rsa-%d", key.N.BitLen()))
+	case *ecdsa.PublicKey:
+		return KeyAlgorithm("ecdsa-" + strings.ToLower(strings.ReplaceAll(key.Curve.Params().Name, "-", "")))
+	case ed25519.PublicKey:
+		return KeyAlgorithmEd25519
+	default:
+		return KeyAlgorithm(fmt.Sprintf("%T", publicKey))
+	}
+}
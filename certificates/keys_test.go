@@ -0,0 +1,155 @@
+package certificates_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/gruyaume/charm-libraries/certificates"
+	"github.com/gruyaume/goops/goopstest"
+)
+
+func TestGeneratePrivateKey(t *testing.T) {
+	tests := []struct {
+		algorithm certificates.KeyAlgorithm
+		check     func(key any) bool
+	}{
+		{certificates.KeyAlgorithmRSA2048, func(key any) bool { k, ok := key.(*rsa.PrivateKey); return ok && k.N.BitLen() == 2048 }},
+		{certificates.KeyAlgorithmRSA3072, func(key any) bool { k, ok := key.(*rsa.PrivateKey); return ok && k.N.BitLen() == 3072 }},
+		{certificates.KeyAlgorithmECDSAP256, func(key any) bool { k, ok := key.(*ecdsa.PrivateKey); return ok && k.Curve.Params().Name == "P-256" }},
+		{certificates.KeyAlgorithmECDSAP384, func(key any) bool { k, ok := key.(*ecdsa.PrivateKey); return ok && k.Curve.Params().Name == "P-384" }},
+		{certificates.KeyAlgorithmEd25519, func(key any) bool { _, ok := key.(ed25519.PrivateKey); return ok }},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.algorithm), func(t *testing.T) {
+			keyPEM, err := certificates.GeneratePrivateKey(tt.algorithm)
+			if err != nil {
+				t.Fatalf("failed to generate private key: %v", err)
+			}
+
+			block, _ := pem.Decode([]byte(keyPEM))
+			if block == nil || block.Type != "PRIVATE KEY" {
+				t.Fatalf("expected a PKCS #8 PEM block")
+			}
+
+			key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+			if err != nil {
+				t.Fatalf("failed to parse private key: %v", err)
+			}
+
+			if !tt.check(key) {
+				t.Fatalf("unexpected private key %T", key)
+			}
+		})
+	}
+}
+
+func TestGeneratePrivateKeyUnsupportedAlgorithm(t *testing.T) {
+	_, err := certificates.GeneratePrivateKey("dsa-1024")
+	if err == nil {
+		t.Fatal("expected an error for an unsupported key algorithm")
+	}
+}
+
+func TestGenerateCertificateKeyAlgorithm(t *testing.T) {
+	certPEM, keyPEM, err := certificates.GenerateCertificate(&certificates.GenerateCertificateOpts{
+		CommonName:       "example.com",
+		ValidityDuration: time.Hour,
+		KeyAlgorithm:     certificates.KeyAlgorithmECDSAP256,
+	})
+	if err != nil {
+		t.Fatalf("failed to generate certificate: %v", err)
+	}
+
+	block, _ := pem.Decode([]byte(certPEM))
+
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		t.Fatalf("failed to parse certificate: %v", err)
+	}
+
+	if cert.PublicKeyAlgorithm != x509.ECDSA {
+		t.Fatalf("expected an ECDSA certificate, got %s", cert.PublicKeyAlgorithm)
+	}
+
+	if cert.KeyUsage&x509.KeyUsageKeyEncipherment != 0 {
+		t.Fatal("expected no key encipherment usage for an ECDSA key")
+	}
+
+	block, _ = pem.Decode([]byte(keyPEM))
+
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		t.Fatalf("failed to parse private key: %v", err)
+	}
+
+	if !cert.PublicKey.(*ecdsa.PublicKey).Equal(key.(*ecdsa.PrivateKey).Public()) {
+		t.Fatal("expected the certificate to match the private key")
+	}
+}
+
+func Ed25519RequestExampleUse() error {
+	integration := &certificates.IntegrationRequirer{
+		RelationName: "certificates",
+		KeyAlgorithm: certificates.KeyAlgorithmEd25519,
+		CertificateRequests: []certificates.CertificateRequestAttributes{
+			{
+				Name:       "server",
+				CommonName: "example.com",
+				SansDNS:    []string{"example.com"},
+			},
+		},
+	}
+
+	err := integration.Request()
+	if err != nil {
+		return fmt.Errorf("failed to request certificate: %w", err)
+	}
+
+	return nil
+}
+
+func TestRequestWithEd25519Key(t *testing.T) {
+	ctx := goopstest.NewContext(
+		Ed25519RequestExampleUse,
+	)
+
+	stateIn := goopstest.State{
+		Relations: []goopstest.Relation{
+			{
+				Endpoint: "certificates",
+			},
+		},
+	}
+
+	stateOut := ctx.Run("start", stateIn)
+
+	if ctx.CharmErr != nil {
+		t.Fatalf("charm error: %v", ctx.CharmErr)
+	}
+
+	var csrData []*RequirerRelationData
+
+	err := json.Unmarshal([]byte(stateOut.Relations[0].LocalUnitData["certificate_signing_requests"]), &csrData)
+	if err != nil {
+		t.Fatalf("failed to unmarshal relation data: %v", err)
+	}
+
+	block, _ := pem.Decode([]byte(csrData[0].CertificateSigningRequest))
+
+	csr, err := parseCSRBlock(block)
+	if err != nil {
+		t.Fatalf("failed to parse certificate signing request: %v", err)
+	}
+
+	if csr.PublicKeyAlgorithm != x509.Ed25519 {
+		t.Fatalf("expected an Ed25519 certificate signing request, got %s", csr.PublicKeyAlgorithm)
+	}
+}
@@ -0,0 +1,84 @@
+//go:build pkcs11
+
+package certificates
+
+import (
+	"fmt"
+
+	"github.com/ThalesIgnite/crypto11"
+)
+
+// PKCS11SignerOptions locates a CA key in a PKCS#11 token, for example an HSM
+// or SoftHSM. The key never leaves the token. The CA certificates are not
+// read from the token, they are passed in Chain as in KeySigner.
+type PKCS11SignerOptions struct {
+	// ModulePath is the path of the PKCS#11 library.
+	ModulePath string
+	TokenLabel string
+	PIN        string
+	// KeyLabel and KeyID select the key pair, at least one is required.
+	KeyLabel string
+	KeyID    []byte
+	Chain    []string
+}
+
+// PKCS11Signer is a KeySigner whose key is held by a PKCS#11 token. It is only
+// available with the pkcs11 build tag, since it needs cgo. Close releases the
+// token session.
+type PKCS11Signer struct {
+	KeySigner
+	context *crypto11.Context
+}
+
+// NewPKCS11Signer opens a session with the token and finds the CA key.
+func NewPKCS11Signer(opts *PKCS11SignerOptions) (*PKCS11Signer, error) {
+	if opts.ModulePath == "" || opts.TokenLabel == "" {
+		return nil, fmt.Errorf("module path and token label are required")
+	}
+
+	if opts.KeyLabel == "" && len(opts.KeyID) == 0 {
+		return nil, fmt.Errorf("key label or key ID is required")
+	}
+
+	context, err := crypto11.Configure(&crypto11.Config{
+		Path:       opts.ModulePath,
+		TokenLabel: opts.TokenLabel,
+		Pin:        opts.PIN,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not open PKCS#11 token: %w", err)
+	}
+
+	var label []byte
+	if opts.KeyLabel != "" {
+		label = []byte(opts.KeyLabel)
+	}
+
+	key, err := context.FindKeyPair(opts.KeyID, label)
+	if err != nil {
+		_ = context.Close()
+		return nil, fmt.Errorf("could not find CA key: %w", err)
+	}
+
+	if key == nil {
+		_ = context.Close()
+		return nil, fmt.Errorf("CA key not found in token %s", opts.TokenLabel)
+	}
+
+	signer := &PKCS11Signer{
+		KeySigner: KeySigner{Chain: opts.Chain, Key: key},
+		context:   context,
+	}
+
+	_, err = signer.issuer()
+	if err != nil {
+		_ = context.Close()
+		return nil, err
+	}
+
+	return signer, nil
+}
+
+func (s *PKCS11Signer) Close() error {
+	return s.context.Close()
+}
@@ -0,0 +1,125 @@
+//go:build pkcs11
+
+package certificates_test
+
+import (
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/ThalesIgnite/crypto11"
+	"github.com/gruyaume/charm-libraries/certificates"
+)
+
+// The test needs a SoftHSM token, for example:
+//
+//	softhsm2-util --init-token --free --label certificates-test --pin 1234 --so-pin 1234
+//	SOFTHSM2_MODULE=/usr/lib/softhsm/libsofthsm2.so SOFTHSM2_TOKEN_LABEL=certificates-test SOFTHSM2_PIN=1234 \
+//		go test -tags pkcs11 ./...
+func softHSMOptions(t *testing.T) *certificates.PKCS11SignerOptions {
+	t.Helper()
+
+	modulePath := os.Getenv("SOFTHSM2_MODULE")
+	if modulePath == "" {
+		t.Skip("SOFTHSM2_MODULE is not set")
+	}
+
+	return &certificates.PKCS11SignerOptions{
+		ModulePath: modulePath,
+		TokenLabel: os.Getenv("SOFTHSM2_TOKEN_LABEL"),
+		PIN:        os.Getenv("SOFTHSM2_PIN"),
+		KeyLabel:   "ca-" + time.Now().Format("20060102150405.000000000"),
+	}
+}
+
+// generateTokenCA creates a CA key in the token and returns a self-signed CA
+// certificate for it.
+func generateTokenCA(t *testing.T, opts *certificates.PKCS11SignerOptions) string {
+	t.Helper()
+
+	context, err := crypto11.Configure(&crypto11.Config{
+		Path:       opts.ModulePath,
+		TokenLabel: opts.TokenLabel,
+		Pin:        opts.PIN,
+	})
+	if err != nil {
+		t.Fatalf("failed to open token: %v", err)
+	}
+
+	defer context.Close()
+
+	key, err := context.GenerateECDSAKeyPairWithLabel([]byte(opts.KeyLabel), []byte(opts.KeyLabel), elliptic.P256())
+	if err != nil {
+		t.Fatalf("failed to generate key in token: %v", err)
+	}
+
+	t.Cleanup(func() {
+		_ = key.Delete()
+	})
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "HSM CA"},
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		t.Fatalf("failed to create CA certificate: %v", err)
+	}
+
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+}
+
+func TestPKCS11SignerSign(t *testing.T) {
+	opts := softHSMOptions(t)
+	caPEM := generateTokenCA(t, opts)
+	opts.Chain = []string{caPEM}
+
+	signer, err := certificates.NewPKCS11Signer(opts)
+	if err != nil {
+		t.Fatalf("failed to create PKCS#11 signer: %v", err)
+	}
+
+	defer signer.Close()
+
+	privateKey, _ := generatePrivateKeyPEM(t)
+	csrPEM := generateCSRForKey(t, privateKey, "server.example.com")
+
+	opt, err := signer.Sign(certificates.RequirerCertificateRequest{
+		RelationID:                "certificates:0",
+		CertificateSigningRequest: certificates.CertificateSigningRequest{Raw: csrPEM},
+	})
+	if err != nil {
+		t.Fatalf("failed to sign: %v", err)
+	}
+
+	roots := x509.NewCertPool()
+	roots.AddCert(parseCertificate(t, caPEM))
+
+	_, err = parseCertificate(t, opt.Certificate).Verify(x509.VerifyOptions{Roots: roots})
+	if err != nil {
+		t.Fatalf("failed to verify issued certificate: %v", err)
+	}
+}
+
+func TestNewPKCS11SignerMissingKey(t *testing.T) {
+	opts := softHSMOptions(t)
+	caPEM, _ := generateTestCA(t)
+	opts.Chain = []string{caPEM}
+
+	_, err := certificates.NewPKCS11Signer(opts)
+	if err == nil {
+		t.Fatalf("expected an error for a key that is not in the token")
+	}
+}
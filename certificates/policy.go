@@ -0,0 +1,243 @@
+package certificates
+
+import (
+	"crypto/rsa"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+)
+
+// Decision is the outcome of evaluating a certificate request against a
+// policy.
+type Decision string
+
+const (
+	DecisionApproved Decision = "approved"
+	DecisionDenied   Decision = "denied"
+	DecisionPending  Decision = "pending"
+)
+
+// PolicyRule inspects a certificate request. A rule without objection
+// returns DecisionApproved. The reason explains any other decision.
+type PolicyRule interface {
+	Evaluate(request RequirerCertificateRequest, csr *x509.CertificateRequest) (Decision, string)
+}
+
+// PolicyRuleFunc adapts a function to a PolicyRule.
+type PolicyRuleFunc func(request RequirerCertificateRequest, csr *x509.CertificateRequest) (Decision, string)
+
+func (f PolicyRuleFunc) Evaluate(request RequirerCertificateRequest, csr *x509.CertificateRequest) (Decision, string) {
+	return f(request, csr)
+}
+
+// Policy approves a request when every rule approves it. A denial wins over
+// a pending decision, and the first rule to deny or defer gives the reason.
+type Policy struct {
+	Rules []PolicyRule
+}
+
+type PolicyResult struct {
+	Request  RequirerCertificateRequest
+	Decision Decision
+	Reason   string
+}
+
+func (p *Policy) Evaluate(request RequirerCertificateRequest) PolicyResult {
+	csr, err := parseCertificateSigningRequestPEM(request.CertificateSigningRequest.Raw)
+	if err != nil {
+		return PolicyResult{Request: request, Decision: DecisionDenied, Reason: err.Error()}
+	}
+
+	result := PolicyResult{Request: request, Decision: DecisionApproved}
+
+	for _, rule := range p.Rules {
+		decision, reason := rule.Evaluate(request, csr)
+
+		switch decision {
+		case DecisionApproved:
+		case DecisionDenied:
+			return PolicyResult{Request: request, Decision: DecisionDenied, Reason: reason}
+		case DecisionPending:
+			if result.Decision == DecisionApproved {
+				result.Decision = DecisionPending
+				result.Reason = reason
+			}
+		default:
+			return PolicyResult{Request: request, Decision: DecisionDenied, Reason: fmt.Sprintf("unknown decision %q", decision)}
+		}
+	}
+
+	return result
+}
+
+// EvaluateOutstandingCertificateRequests sorts the certificate requests that
+// have no certificate yet with the policy.
+func (p *IntegrationProvider) EvaluateOutstandingCertificateRequests(policy *Policy) ([]PolicyResult, error) {
+	status, err := p.GetCertificateRequestsStatus(RenewalPolicy{})
+	if err != nil {
+		return nil, fmt.Errorf("could not get certificate requests status: %w", err)
+	}
+
+	results := make([]PolicyResult, 0, len(status.Outstanding))
+
+	for _, request := range status.Outstanding {
+		results = append(results, policy.Evaluate(request))
+	}
+
+	return results, nil
+}
+
+// AllowedDomainsRule denies DNS SANs outside the allowed domain suffixes. A
+// suffix allows the domain itself and its subdomains. Wildcard names are
+// denied unless AllowWildcards is set. The common name is held to the same
+// rules, since clients fall back to it when there are no DNS SANs.
+type AllowedDomainsRule struct {
+	Suffixes       []string
+	AllowWildcards bool
+}
+
+func (r AllowedDomainsRule) Evaluate(_ RequirerCertificateRequest, csr *x509.CertificateRequest) (Decision, string) {
+	names := slices.Clone(csr.DNSNames)
+	if csr.Subject.CommonName != "" {
+		names = append(names, csr.Subject.CommonName)
+	}
+
+	for _, name := range names {
+		domain := strings.ToLower(name)
+
+		if strings.HasPrefix(domain, "*.") {
+			if !r.AllowWildcards {
+				return DecisionDenied, fmt.Sprintf("wildcard name %s is not allowed", name)
+			}
+
+			domain = strings.TrimPrefix(domain, "*.")
+		}
+
+		if strings.Contains(domain, "*") {
+			return DecisionDenied, fmt.Sprintf("name %s has a wildcard outside the leftmost label", name)
+		}
+
+		if !domainAllowed(domain, r.Suffixes) {
+			return DecisionDenied, fmt.Sprintf("name %s is not in an allowed domain", name)
+		}
+	}
+
+	return DecisionApproved, ""
+}
+
+func domainAllowed(domain string, suffixes []string) bool {
+	for _, suffix := range suffixes {
+		suffix = strings.ToLower(strings.TrimPrefix(suffix, "."))
+
+		if domain == suffix || strings.HasSuffix(domain, "."+suffix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// AllowedIPRangesRule denies IP SANs outside the allowed ranges.
+type AllowedIPRangesRule struct {
+	Ranges []*net.IPNet
+}
+
+func (r AllowedIPRangesRule) Evaluate(_ RequirerCertificateRequest, csr *x509.CertificateRequest) (Decision, string) {
+	for _, ip := range csr.IPAddresses {
+		allowed := slices.ContainsFunc(r.Ranges, func(ipRange *net.IPNet) bool {
+			return ipRange.Contains(ip)
+		})
+		if !allowed {
+			return DecisionDenied, fmt.Sprintf("IP address %s is not in an allowed range", ip)
+		}
+	}
+
+	return DecisionApproved, ""
+}
+
+// ForbidCARule denies requests for a CA certificate.
+type ForbidCARule struct{}
+
+func (ForbidCARule) Evaluate(request RequirerCertificateRequest, _ *x509.CertificateRequest) (Decision, string) {
+	if request.IsCA {
+		return DecisionDenied, "CA certificates are not allowed"
+	}
+
+	return DecisionApproved, ""
+}
+
+// RequiredSubjectFieldsRule denies requests that leave a required subject
+// field empty.
+type RequiredSubjectFieldsRule struct {
+	CommonName          bool
+	Organization        bool
+	OrganizationalUnit  bool
+	CountryName         bool
+	StateOrProvinceName bool
+	LocalityName        bool
+	EmailAddress        bool
+}
+
+func (r RequiredSubjectFieldsRule) Evaluate(request RequirerCertificateRequest, _ *x509.CertificateRequest) (Decision, string) {
+	csr := request.CertificateSigningRequest
+
+	fields := []struct {
+		required bool
+		value    string
+		name     string
+	}{
+		{r.CommonName, csr.CommonName, "common name"},
+		{r.Organization, csr.Organization, "organization"},
+		{r.OrganizationalUnit, csr.OrganizationalUnit, "organizational unit"},
+		{r.CountryName, csr.CountryName, "country name"},
+		{r.StateOrProvinceName, csr.StateOrProvinceName, "state or province name"},
+		{r.LocalityName, csr.LocalityName, "locality name"},
+		{r.EmailAddress, csr.EmailAddress, "email address"},
+	}
+
+	for _, field := range fields {
+		if field.required && field.value == "" {
+			return DecisionDenied, fmt.Sprintf("%s is required", field.name)
+		}
+	}
+
+	return DecisionApproved, ""
+}
+
+// KeyAlgorithmRule denies RSA keys below MinRSABits and, when
+// AllowedAlgorithms is set, keys of any other algorithm.
+type KeyAlgorithmRule struct {
+	MinRSABits        int
+	AllowedAlgorithms []KeyAlgorithm
+}
+
+func (r KeyAlgorithmRule) Evaluate(_ RequirerCertificateRequest, csr *x509.CertificateRequest) (Decision, string) {
+	algorithm := keyAlgorithmOf(csr.PublicKey)
+
+	if len(r.AllowedAlgorithms) > 0 && !slices.Contains(r.AllowedAlgorithms, algorithm) {
+		return DecisionDenied, fmt.Sprintf("key algorithm %s is not allowed", algorithm)
+	}
+
+	if rsaKey, ok := csr.PublicKey.(*rsa.PublicKey); ok && rsaKey.N.BitLen() < r.MinRSABits {
+		return DecisionDenied, fmt.Sprintf("RSA key of %d bits is below the minimum of %d", rsaKey.N.BitLen(), r.MinRSABits)
+	}
+
+	return DecisionApproved, ""
+}
+
+// MaxSANsRule denies requests with more than Max subject alternative names.
+type MaxSANsRule struct {
+	Max int
+}
+
+func (r MaxSANsRule) Evaluate(request RequirerCertificateRequest, csr *x509.CertificateRequest) (Decision, string) {
+	count := len(csr.DNSNames) + len(csr.IPAddresses) + len(csr.EmailAddresses) + len(csr.URIs) +
+		len(request.CertificateSigningRequest.SansOID)
+	if count > r.Max {
+		return DecisionDenied, fmt.Sprintf("%d subject alternative names exceed the limit of %d", count, r.Max)
+	}
+
+	return DecisionApproved, ""
+}
@@ -0,0 +1,185 @@
+package certificates_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/gruyaume/charm-libraries/certificates"
+	"github.com/gruyaume/goops/goopstest"
+)
+
+func newPolicy() *certificates.Policy {
+	_, privateRange, _ := net.ParseCIDR("10.0.0.0/8")
+
+	return &certificates.Policy{
+		Rules: []certificates.PolicyRule{
+			certificates.ForbidCARule{},
+			certificates.AllowedDomainsRule{Suffixes: []string{"example.com"}},
+			certificates.AllowedIPRangesRule{Ranges: []*net.IPNet{privateRange}},
+			certificates.RequiredSubjectFieldsRule{CommonName: true},
+			certificates.KeyAlgorithmRule{
+				MinRSABits:        2048,
+				AllowedAlgorithms: []certificates.KeyAlgorithm{certificates.KeyAlgorithmRSA2048, certificates.KeyAlgorithmECDSAP256},
+			},
+			certificates.MaxSANsRule{Max: 3},
+		},
+	}
+}
+
+func EvaluateOutstandingCertificateRequestsExampleUse() error {
+	ip := &certificates.IntegrationProvider{
+		RelationName: "certificates",
+	}
+
+	results, err := ip.EvaluateOutstandingCertificateRequests(newPolicy())
+	if err != nil {
+		return fmt.Errorf("failed to evaluate outstanding certificate requests: %w", err)
+	}
+
+	for _, result := range results {
+		expected := certificates.DecisionDenied
+		if result.Request.CertificateSigningRequest.CommonName == "approved.example.com" {
+			expected = certificates.DecisionApproved
+		}
+
+		if result.Decision != expected {
+			return fmt.Errorf("expected %s to be %s, got %s (%s)", result.Request.CertificateSigningRequest.CommonName, expected, result.Decision, result.Reason)
+		}
+
+		if result.Decision == certificates.DecisionDenied && result.Reason == "" {
+			return fmt.Errorf("expected a reason for denying %s", result.Request.CertificateSigningRequest.CommonName)
+		}
+	}
+
+	return nil
+}
+
+func newPolicyCSR(t *testing.T, key any, template *x509.CertificateRequest) string {
+	t.Helper()
+
+	csrBytes, err := x509.CreateCertificateRequest(rand.Reader, template, key)
+	if err != nil {
+		t.Fatalf("failed to create certificate request: %v", err)
+	}
+
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: csrBytes}))
+}
+
+func TestEvaluateOutstandingCertificateRequests(t *testing.T) {
+	ctx := goopstest.NewContext(
+		EvaluateOutstandingCertificateRequestsExampleUse,
+		goopstest.WithUnitID("provider/0"),
+		goopstest.WithAppName("provider"),
+	)
+
+	rsaKey, _ := generatePrivateKeyPEM(t)
+
+	ecdsaKey, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate ECDSA key: %v", err)
+	}
+
+	smallRSAKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatalf("failed to generate RSA key: %v", err)
+	}
+
+	type request struct {
+		CSR string `json:"certificate_signing_request"`
+		CA  bool   `json:"ca"`
+	}
+
+	requests := []request{
+		{CSR: newPolicyCSR(t, rsaKey, &x509.CertificateRequest{
+			Subject:     pkix.Name{CommonName: "approved.example.com"},
+			DNSNames:    []string{"example.com", "db.example.com"},
+			IPAddresses: []net.IP{net.ParseIP("10.1.2.3")},
+		})},
+		{CSR: newPolicyCSR(t, rsaKey, &x509.CertificateRequest{Subject: pkix.Name{CommonName: "ca"}}), CA: true},
+		{CSR: newPolicyCSR(t, rsaKey, &x509.CertificateRequest{
+			Subject:  pkix.Name{CommonName: "other-domain"},
+			DNSNames: []string{"example.org"},
+		})},
+		{CSR: newPolicyCSR(t, rsaKey, &x509.CertificateRequest{
+			Subject:  pkix.Name{CommonName: "wildcard"},
+			DNSNames: []string{"*.example.com"},
+		})},
+		{CSR: newPolicyCSR(t, rsaKey, &x509.CertificateRequest{
+			Subject:     pkix.Name{CommonName: "public-ip"},
+			IPAddresses: []net.IP{net.ParseIP("8.8.8.8")},
+		})},
+		{CSR: newPolicyCSR(t, rsaKey, &x509.CertificateRequest{Subject: pkix.Name{CommonName: "evil.com"}})},
+		{CSR: newPolicyCSR(t, rsaKey, &x509.CertificateRequest{DNSNames: []string{"example.com"}})},
+		{CSR: newPolicyCSR(t, ecdsaKey, &x509.CertificateRequest{Subject: pkix.Name{CommonName: "p384"}})},
+		{CSR: newPolicyCSR(t, smallRSAKey, &x509.CertificateRequest{Subject: pkix.Name{CommonName: "small-rsa"}})},
+		{CSR: newPolicyCSR(t, rsaKey, &x509.CertificateRequest{
+			Subject:  pkix.Name{CommonName: "too-many-sans"},
+			DNSNames: []string{"a.example.com", "b.example.com", "c.example.com", "d.example.com"},
+		})},
+	}
+
+	requestData, err := json.Marshal(requests)
+	if err != nil {
+		t.Fatalf("failed to marshal request data: %v", err)
+	}
+
+	stateIn := goopstest.State{
+		Leader: true,
+		Relations: []goopstest.Relation{
+			{
+				Endpoint:      "certificates",
+				RemoteAppName: "requirer",
+				RemoteUnitsData: map[goopstest.UnitID]goopstest.DataBag{
+					"requirer/0": {
+						"certificate_signing_requests": string(requestData),
+					},
+				},
+			},
+		},
+	}
+
+	_ = ctx.Run("start", stateIn)
+
+	if ctx.CharmErr != nil {
+		t.Fatalf("charm error: %v", ctx.CharmErr)
+	}
+}
+
+func TestPolicyCustomRule(t *testing.T) {
+	privateKey, _ := generatePrivateKeyPEM(t)
+	csr := generateCSRForKey(t, privateKey, "server.example.com")
+
+	request := certificates.RequirerCertificateRequest{
+		RelationID:                "certificates:0",
+		CertificateSigningRequest: certificates.CertificateSigningRequest{Raw: csr},
+	}
+
+	manualApproval := certificates.PolicyRuleFunc(func(certificates.RequirerCertificateRequest, *x509.CertificateRequest) (certificates.Decision, string) {
+		return certificates.DecisionPending, "waiting for manual approval"
+	})
+
+	policy := &certificates.Policy{
+		Rules: []certificates.PolicyRule{manualApproval},
+	}
+
+	result := policy.Evaluate(request)
+	if result.Decision != certificates.DecisionPending || result.Reason != "waiting for manual approval" {
+		t.Fatalf("expected the request to be pending manual approval, got %s (%s)", result.Decision, result.Reason)
+	}
+
+	policy.Rules = append(policy.Rules, certificates.AllowedDomainsRule{Suffixes: []string{"example.org"}})
+
+	result = policy.Evaluate(request)
+	if result.Decision != certificates.DecisionDenied {
+		t.Fatalf("expected a denial to win over a pending decision, got %s", result.Decision)
+	}
+}
@@ -1,10 +1,12 @@
 package certificates
 
 import (
+	"crypto/sha256"
 	"crypto/x509"
-	"encoding/json"
 	"encoding/pem"
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/gruyaume/goops"
 )
@@ -13,17 +15,13 @@ type IntegrationProvider struct {
 	RelationName string
 }
 
-type CertificateSigningRequestRequirerRelationData struct {
-	CertificateSigningRequest string `json:"certificate_signing_request"`
-	CA                        bool   `json:"ca"`
-}
+// CertificateSigningRequestRequirerRelationData is the former name of
+// CertificateSigningRequestV4.
+type CertificateSigningRequestRequirerRelationData = CertificateSigningRequestV4
 
-type CertificateSigningRequestProviderAppRelationData struct {
-	CA                        string   `json:"ca"`
-	Chain                     []string `json:"chain"`
-	CertificateSigningRequest string   `json:"certificate_signing_request"`
-	Certificate               string   `json:"certificate"`
-}
+// CertificateSigningRequestProviderAppRelationData is the former name of
+// CertificateV4.
+type CertificateSigningRequestProviderAppRelationData = CertificateV4
 
 type ProviderAppRelationData struct {
 	Certificates string `json:"certificates"`
@@ -47,6 +45,9 @@ type RequirerCertificateRequest struct {
 	RelationID                string
 	CertificateSigningRequest CertificateSigningRequest
 	IsCA                      bool
+	// Mode tells whether the request was found in a unit data bag or in the
+	// requirer's app data bag.
+	Mode Mode
 }
 
 type Certificate struct {
@@ -64,63 +65,144 @@ type Certificate struct {
 	CountryName         string
 	StateOrProvinceName string
 	LocalityName        string
+	NotBefore           time.Time
+	NotAfter            time.Time
+	// Fingerprint is the SHA-256 digest of the DER certificate, as colon
+	// separated upper case hex.
+	Fingerprint  string
+	SerialNumber string
+	Issuer       string
+	KeyAlgorithm KeyAlgorithm
+}
+
+// CertificateRequestFailure describes a certificate request the provider
+// could not read. Unit is empty for requests found in the requirer's app data
+// bag. CertificateSigningRequest is empty when the whole data bag could not
+// be decoded.
+type CertificateRequestFailure struct {
+	RelationID                string
+	Unit                      string
+	Mode                      Mode
+	CertificateSigningRequest string
+	Err                       error
 }
 
-func (p *IntegrationProvider) GetOutstandingCertificateRequests() ([]RequirerCertificateRequest, error) {
+// GetOutstandingCertificateRequests returns the certificate signing requests
+// published by the requirers, both in their unit data bags and in their app
+// data bags. A data bag or a certificate signing request that cannot be read
+// does not prevent returning the others, it is reported as a failure. The
+// error is only set when the relations themselves cannot be read. Requests
+// that already have a certificate are included, GetCertificateRequestsStatus
+// tells them apart.
+func (p *IntegrationProvider) GetOutstandingCertificateRequests() ([]RequirerCertificateRequest, []CertificateRequestFailure, error) {
 	if p.RelationName == "" {
-		return nil, fmt.Errorf("relation name is empty")
+		return nil, nil, fmt.Errorf("relation name is empty")
 	}
 
 	relationIDs, err := goops.GetRelationIDs(p.RelationName)
 	if err != nil {
-		return nil, fmt.Errorf("could not get relation IDs: %w", err)
+		return nil, nil, fmt.Errorf("could not get relation IDs: %w", err)
 	}
 
 	requirerCertificateRequests := make([]RequirerCertificateRequest, 0)
+	failures := make([]CertificateRequestFailure, 0)
 
 	for _, relationID := range relationIDs {
-		relationUnits, err := goops.ListRelationUnits(relationID)
+		requests, relationFailures, err := readRequirerCertificateRequests(relationID)
 		if err != nil {
-			return nil, fmt.Errorf("could not list relation units: %w", err)
+			return nil, nil, err
 		}
 
-		for _, unitID := range relationUnits {
-			relationData, err := goops.GetUnitRelationData(relationID, unitID)
-			if err != nil {
-				return nil, fmt.Errorf("could not get relation data: %w", err)
-			}
+		requirerCertificateRequests = append(requirerCertificateRequests, requests...)
+		failures = append(failures, relationFailures...)
+	}
 
-			csrJSON, ok := relationData["certificate_signing_requests"]
-			if !ok {
-				continue
-			}
+	return requirerCertificateRequests, failures, nil
+}
 
-			var certificateSigningRequestsRelationData []CertificateSigningRequestRequirerRelationData
+// readRequirerCertificateRequests reads the certificate requests of the
+// requirer units and app of a relation.
+func readRequirerCertificateRequests(relationID string) ([]RequirerCertificateRequest, []CertificateRequestFailure, error) {
+	relationUnits, err := goops.ListRelationUnits(relationID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not list relation units: %w", err)
+	}
 
-			err = json.Unmarshal([]byte(csrJSON), &certificateSigningRequestsRelationData)
-			if err != nil {
-				return nil, fmt.Errorf("could not unmarshal certificate signing requests: %w", err)
-			}
+	requirerCertificateRequests := make([]RequirerCertificateRequest, 0)
+	failures := make([]CertificateRequestFailure, 0)
 
-			for _, csrRelationData := range certificateSigningRequestsRelationData {
-				csrString := csrRelationData.CertificateSigningRequest
+	for _, unitID := range relationUnits {
+		relationData, err := goops.GetUnitRelationData(relationID, unitID)
+		if err != nil {
+			return nil, nil, fmt.Errorf("could not get relation data: %w", err)
+		}
 
-				csr, err := loadCertificateSigningRequest(csrString)
-				if err != nil {
-					return nil, fmt.Errorf("could not parse certificate signing request: %w", err)
-				}
+		requests, unitFailures := parseRequirerCertificateRequests(relationID, relationData, ModeUnit)
+		for i := range unitFailures {
+			unitFailures[i].Unit = unitID
+		}
 
-				requirerCertificateRequest := RequirerCertificateRequest{
-					RelationID:                relationID,
-					CertificateSigningRequest: csr,
-					IsCA:                      csrRelationData.CA,
-				}
-				requirerCertificateRequests = append(requirerCertificateRequests, requirerCertificateRequest)
-			}
+		requirerCertificateRequests = append(requirerCertificateRequests, requests...)
+		failures = append(failures, unitFailures...)
+	}
+
+	if len(relationUnits) > 0 {
+		appRelationData, err := goops.GetAppRelationData(relationID, relationUnits[0])
+		if err != nil {
+			return nil, nil, fmt.Errorf("could not get app relation data: %w", err)
 		}
+
+		requests, appFailures := parseRequirerCertificateRequests(relationID, appRelationData, ModeApp)
+
+		requirerCertificateRequests = append(requirerCertificateRequests, requests...)
+		failures = append(failures, appFailures...)
 	}
 
-	return requirerCertificateRequests, nil
+	for _, failure := range failures {
+		goops.LogWarningf("Ignoring certificate request in relation %s: %v", failure.RelationID, failure.Err)
+	}
+
+	return requirerCertificateRequests, failures, nil
+}
+
+func parseRequirerCertificateRequests(relationID string, relationData map[string]string, mode Mode) ([]RequirerCertificateRequest, []CertificateRequestFailure) {
+	var databag RequirerDatabagV4
+
+	err := databag.Load(relationData)
+	if err != nil {
+		return nil, []CertificateRequestFailure{{RelationID: relationID, Mode: mode, Err: err}}
+	}
+
+	certificateSigningRequestsRelationData := databag.CertificateSigningRequests
+
+	requirerCertificateRequests := make([]RequirerCertificateRequest, 0, len(certificateSigningRequestsRelationData))
+	failures := make([]CertificateRequestFailure, 0)
+
+	for _, csrRelationData := range certificateSigningRequestsRelationData {
+		csrString := csrRelationData.CertificateSigningRequest
+
+		csr, err := loadCertificateSigningRequest(csrString)
+		if err != nil {
+			failures = append(failures, CertificateRequestFailure{
+				RelationID:                relationID,
+				Mode:                      mode,
+				CertificateSigningRequest: csrString,
+				Err:                       fmt.Errorf("could not parse certificate signing request: %w", err),
+			})
+
+			continue
+		}
+
+		requirerCertificateRequest := RequirerCertificateRequest{
+			RelationID:                relationID,
+			CertificateSigningRequest: csr,
+			IsCA:                      csrRelationData.CA,
+			Mode:                      mode,
+		}
+		requirerCertificateRequests = append(requirerCertificateRequests, requirerCertificateRequest)
+	}
+
+	return requirerCertificateRequests, failures
 }
 
 // alreadyProvided checks if we've already pushed this CSR into the relation.
@@ -148,7 +230,19 @@ type SetRelationCertificateOptions struct {
 	Certificate               string
 }
 
+// SetRelationCertificate publishes a certificate in the relation. An entry
+// already published for the same certificate signing request is replaced,
+// every other entry is kept. The certificate is verified as in
+// SetRelationCertificates.
 func (p *IntegrationProvider) SetRelationCertificate(opts *SetRelationCertificateOptions) error {
+	return p.SetRelationCertificates([]*SetRelationCertificateOptions{opts})
+}
+
+// SetRelationCertificates publishes a batch of certificates. The data bag of
+// each relation involved is read and written once. Every certificate is
+// verified against its certificate signing request and CA first, nothing is
+// published if one of them fails.
+func (p *IntegrationProvider) SetRelationCertificates(opts []*SetRelationCertificateOptions) error {
 	isLeader, err := goops.IsLeader()
 	if err != nil {
 		return fmt.Errorf("could not determine if unit is leader: %w", err)
@@ -158,27 +252,94 @@ func (p *IntegrationProvider) SetRelationCertificate(opts *SetRelationCertificat
 		return fmt.Errorf("unit is not the leader and cannot set app relation data")
 	}
 
-	appData := []CertificateSigningRequestProviderAppRelationData{
-		{
-			CA:                        opts.CA,
-			Chain:                     []string{},
-			CertificateSigningRequest: opts.CertificateSigningRequest,
-			Certificate:               opts.Certificate,
-		},
+	relationIDs := make([]string, 0)
+	optsByRelation := make(map[string][]*SetRelationCertificateOptions)
+
+	for _, opt := range opts {
+		if opt == nil {
+			continue
+		}
+
+		err := verifyRelationCertificate(opt)
+		if err != nil {
+			return fmt.Errorf("could not verify certificate for relation %s: %w", opt.RelationID, err)
+		}
+
+		if _, ok := optsByRelation[opt.RelationID]; !ok {
+			relationIDs = append(relationIDs, opt.RelationID)
+		}
+
+		optsByRelation[opt.RelationID] = append(optsByRelation[opt.RelationID], opt)
 	}
 
-	appData[0].Chain = append(appData[0].Chain, opts.Chain...)
+	for _, relationID := range relationIDs {
+		appData, err := p.getProviderAppRelationData(relationID)
+		if err != nil {
+			return fmt.Errorf("could not get provider app relation data: %w", err)
+		}
 
-	appDataJSON, err := json.Marshal(appData)
+		for _, opt := range optsByRelation[relationID] {
+			entry := CertificateV4{
+				CA:                        opt.CA,
+				Chain:                     []string{},
+				CertificateSigningRequest: opt.CertificateSigningRequest,
+				Certificate:               opt.Certificate,
+			}
+
+			entry.Chain = append(entry.Chain, opt.Chain...)
+
+			appData = upsertProviderCertificate(appData, entry)
+		}
+
+		err = p.setProviderAppRelationData(relationID, appData)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func upsertProviderCertificate(appData []CertificateV4, entry CertificateV4) []CertificateV4 {
+	for i := range appData {
+		if appData[i].CertificateSigningRequest == entry.CertificateSigningRequest {
+			appData[i] = entry
+			return appData
+		}
+	}
+
+	return append(appData, entry)
+}
+
+// getProviderAppRelationData returns the certificates already published in the
+// relation. A relation without a certificates key has no certificates yet.
+func (p *IntegrationProvider) getProviderAppRelationData(relationID string) ([]CertificateV4, error) {
+	env := goops.ReadEnv()
+
+	relationData, err := goops.GetAppRelationData(relationID, env.UnitName)
+	if err != nil {
+		return nil, fmt.Errorf("could not get relation data: %w", err)
+	}
+
+	var databag ProviderDatabagV4
+
+	err = databag.Load(relationData)
 	if err != nil {
-		return fmt.Errorf("could not marshal app data: %w", err)
+		return nil, err
 	}
 
-	relationData := map[string]string{
-		"certificates": string(appDataJSON),
+	return databag.Certificates, nil
+}
+
+func (p *IntegrationProvider) setProviderAppRelationData(relationID string, appData []CertificateV4) error {
+	databag := ProviderDatabagV4{Certificates: appData}
+
+	relationData, err := databag.Dump()
+	if err != nil {
+		return err
 	}
 
-	err = goops.SetAppRelationData(opts.RelationID, relationData)
+	err = goops.SetAppRelationData(relationID, relationData)
 	if err != nil {
 		return fmt.Errorf("could not set relation data: %w", err)
 	}
@@ -187,20 +348,33 @@ func (p *IntegrationProvider) SetRelationCertificate(opts *SetRelationCertificat
 }
 
 func loadCertificateSigningRequest(pemString string) (CertificateSigningRequest, error) {
+	csr, err := parseCertificateSigningRequestPEM(pemString)
+	if err != nil {
+		return CertificateSigningRequest{}, err
+	}
+
+	return newCertificateSigningRequest(pemString, csr), nil
+}
+
+func parseCertificateSigningRequestPEM(pemString string) (*x509.CertificateRequest, error) {
 	block, _ := pem.Decode([]byte(pemString))
 	if block == nil {
-		return CertificateSigningRequest{}, fmt.Errorf("failed to decode PEM block containing the certificate signing request")
+		return nil, fmt.Errorf("failed to decode PEM block containing the certificate signing request")
 	}
 
 	csr, err := x509.ParseCertificateRequest(block.Bytes)
 	if err != nil {
-		return CertificateSigningRequest{}, fmt.Errorf("failed to parse certificate signing request: %w", err)
+		return nil, fmt.Errorf("failed to parse certificate signing request: %w", err)
 	}
 
 	if err := csr.CheckSignature(); err != nil {
-		return CertificateSigningRequest{}, fmt.Errorf("CSR signature validation failed: %w", err)
+		return nil, fmt.Errorf("CSR signature validation failed: %w", err)
 	}
 
+	return csr, nil
+}
+
+func newCertificateSigningRequest(pemString string, csr *x509.CertificateRequest) CertificateSigningRequest {
 	var email string
 	if len(csr.EmailAddresses) > 0 {
 		email = csr.EmailAddresses[0]
@@ -236,19 +410,85 @@ func loadCertificateSigningRequest(pemString string) (CertificateSigningRequest,
 		sansIP = append(sansIP, ip.String())
 	}
 
+	// The extension was already validated by x509.ParseCertificateRequest.
+	sansOID, _ := parseSubjectAltNameOIDs(csr.Extensions)
+
 	return CertificateSigningRequest{
 		Raw:                 pemString,
 		CommonName:          csr.Subject.CommonName,
 		SansDNS:             csr.DNSNames,
 		SansIP:              sansIP,
-		SansOID:             []string{}, // Not populated from the CSR directly.
+		SansOID:             sansOID,
 		EmailAddress:        email,
 		Organization:        organization,
 		OrganizationalUnit:  organizationalUnit,
 		CountryName:         countryName,
 		StateOrProvinceName: stateOrProvinceName,
 		LocalityName:        localityName,
-	}, nil
+	}
+}
+
+// ParseCertificate parses a PEM encoded certificate.
+func ParseCertificate(pemString string) (Certificate, error) {
+	cert, err := parseCertificatePEM(pemString)
+	if err != nil {
+		return Certificate{}, err
+	}
+
+	return newCertificate(pemString, cert), nil
+}
+
+func newCertificate(pemString string, cert *x509.Certificate) Certificate {
+	var email string
+	if len(cert.EmailAddresses) > 0 {
+		email = cert.EmailAddresses[0]
+	}
+
+	var sansIP []string
+	for _, ip := range cert.IPAddresses {
+		sansIP = append(sansIP, ip.String())
+	}
+
+	// The extension was already validated by x509.ParseCertificate.
+	sansOID, _ := parseSubjectAltNameOIDs(cert.Extensions)
+
+	digest := sha256.Sum256(cert.Raw)
+
+	fingerprint := make([]string, len(digest))
+	for i, b := range digest {
+		fingerprint[i] = fmt.Sprintf("%02X", b)
+	}
+
+	return Certificate{
+		Raw:                 pemString,
+		CommonName:          cert.Subject.CommonName,
+		ExpiryTime:          cert.NotAfter.UTC().Format(time.RFC3339),
+		ValidityStartTime:   cert.NotBefore.UTC().Format(time.RFC3339),
+		IsCA:                cert.IsCA,
+		SansDNS:             cert.DNSNames,
+		SansIP:              sansIP,
+		SansOID:             sansOID,
+		EmailAddress:        email,
+		Organization:        firstOrEmpty(cert.Subject.Organization),
+		OrganizationalUnit:  firstOrEmpty(cert.Subject.OrganizationalUnit),
+		CountryName:         firstOrEmpty(cert.Subject.Country),
+		StateOrProvinceName: firstOrEmpty(cert.Subject.Province),
+		LocalityName:        firstOrEmpty(cert.Subject.Locality),
+		NotBefore:           cert.NotBefore,
+		NotAfter:            cert.NotAfter,
+		Fingerprint:         strings.Join(fingerprint, ":"),
+		SerialNumber:        cert.SerialNumber.String(),
+		Issuer:              cert.Issuer.String(),
+		KeyAlgorithm:        keyAlgorithmOf(cert.PublicKey),
+	}
+}
+
+func firstOrEmpty(values []string) string {
+	if len(values) == 0 {
+		return ""
+	}
+
+	return values[0]
 }
 
 func (p *IntegrationProvider) GetIssuedCertificates(relationID string) ([]*ProviderCertificate, error) {
@@ -263,36 +503,20 @@ func (p *IntegrationProvider) GetIssuedCertificates(relationID string) ([]*Provi
 		return nil, fmt.Errorf("relation data is empty")
 	}
 
-	certificatesStr, ok := relationData["certificates"]
-	if !ok {
+	if _, ok := relationData[certificatesKey]; !ok {
 		return nil, fmt.Errorf("relation data does not contain certificates")
 	}
 
-	var certificates []map[string]string
+	var databag ProviderDatabagV4
 
-	err = json.Unmarshal([]byte(certificatesStr), &certificates)
+	err = databag.Load(relationData)
 	if err != nil {
-		return nil, fmt.Errorf("could not unmarshal certificates: %w", err)
+		return nil, err
 	}
 
-	providerCertificates := make([]*ProviderCertificate, 0)
-	for _, certData := range certificates {
-		certificate := &ProviderCertificate{
-			Certificate:               certData["certificate"],
-			CA:                        certData["ca"],
-			CertificateSigningRequest: certData["certificate_signing_request"],
-		}
-		var chain []string
-		chainJSON, ok := certData["chain"]
-		if !ok {
-			return nil, fmt.Errorf("relation data does not contain chain")
-		}
-		if err := json.Unmarshal([]byte(chainJSON), &chain); err != nil {
-			return nil, fmt.Errorf("could not unmarshal chain array: %w", err)
-		}
-		certificate.Chain = chain
-
-		providerCertificates = append(providerCertificates, certificate)
+	providerCertificates := make([]*ProviderCertificate, 0, len(databag.Certificates))
+	for _, certData := range databag.Certificates {
+		providerCertificates = append(providerCertificates, newProviderCertificate(certData))
 	}
 
 	return providerCertificates, nil
@@ -8,7 +8,9 @@ import (
 	"encoding/json"
 	"encoding/pem"
 	"fmt"
+	"net"
 	"testing"
+	"time"
 
 	"github.com/gruyaume/charm-libraries/certificates"
 	"github.com/gruyaume/goops/goopstest"
@@ -19,7 +21,7 @@ func GetOutstandingCertificateRequestsExampleUse() error {
 		RelationName: "certificates",
 	}
 
-	requirerRequests, err := ip.GetOutstandingCertificateRequests()
+	requirerRequests, _, err := ip.GetOutstandingCertificateRequests()
 	if err != nil {
 		return fmt.Errorf("failed to get outstanding certificate requests: %w", err)
 	}
@@ -199,17 +201,59 @@ func TestGetIssuedCertificates(t *testing.T) {
 	}
 }
 
-func SetRelationCertificateExampleUse() error {
-	ip := &certificates.IntegrationProvider{
-		RelationName: "certificates",
+// generateTestCA returns a new test CA certificate and its private key.
+func generateTestCA(t *testing.T) (string, string) {
+	t.Helper()
+
+	caPEM, caKeyPEM, err := certificates.GenerateCA(&certificates.GenerateCAOpts{
+		CommonName:       "Test CA",
+		ValidityDuration: 24 * time.Hour,
+		KeyAlgorithm:     certificates.KeyAlgorithmECDSAP256,
+	})
+	if err != nil {
+		t.Fatalf("failed to generate CA: %v", err)
 	}
 
-	opts := &certificates.SetRelationCertificateOptions{
-		RelationID:                "certificates:0",
-		CA:                        "test-ca",
-		Chain:                     []string{"example-cert", "test-ca"},
-		CertificateSigningRequest: "example-csr",
-		Certificate:               "example-cert",
+	return caPEM, caKeyPEM
+}
+
+// signTestCSR signs the certificate signing request with the test CA.
+func signTestCSR(t *testing.T, csrPEM string, caPEM string, caKeyPEM string) string {
+	t.Helper()
+
+	certPEM, err := certificates.SignCertificateSigningRequest(csrPEM, caPEM, caKeyPEM, &certificates.SignCertificateSigningRequestOpts{
+		ValidityDuration: time.Hour,
+	})
+	if err != nil {
+		t.Fatalf("failed to sign certificate signing request: %v", err)
+	}
+
+	return certPEM
+}
+
+// issueTestCertificate returns the options to publish a certificate signed by
+// a new test CA for a new certificate signing request.
+func issueTestCertificate(t *testing.T, relationID string, commonName string) *certificates.SetRelationCertificateOptions {
+	t.Helper()
+
+	caPEM, caKeyPEM := generateTestCA(t)
+
+	privateKey, _ := generatePrivateKeyPEM(t)
+	csrPEM := generateCSRForKey(t, privateKey, commonName)
+	certPEM := signTestCSR(t, csrPEM, caPEM, caKeyPEM)
+
+	return &certificates.SetRelationCertificateOptions{
+		RelationID:                relationID,
+		CA:                        caPEM,
+		Chain:                     []string{certPEM, caPEM},
+		CertificateSigningRequest: csrPEM,
+		Certificate:               certPEM,
+	}
+}
+
+func SetRelationCertificateExampleUse(opts *certificates.SetRelationCertificateOptions) error {
+	ip := &certificates.IntegrationProvider{
+		RelationName: "certificates",
 	}
 
 	err := ip.SetRelationCertificate(opts)
@@ -221,8 +265,10 @@ func SetRelationCertificateExampleUse() error {
 }
 
 func TestSetRelationCertificate(t *testing.T) {
+	opts := issueTestCertificate(t, "certificates:0", "example.com")
+
 	ctx := goopstest.NewContext(
-		SetRelationCertificateExampleUse,
+		func() error { return SetRelationCertificateExampleUse(opts) },
 	)
 
 	certificatesRelation := goopstest.Relation{
@@ -264,7 +310,373 @@ func TestSetRelationCertificate(t *testing.T) {
 		t.Fatalf("expected 1 certificate, got %d", len(certs))
 	}
 
-	if certs[0].CA != "test-ca" || certs[0].CertificateSigningRequest != "example-csr" || certs[0].Certificate != "example-cert" {
+	if certs[0].CA != opts.CA || certs[0].CertificateSigningRequest != opts.CertificateSigningRequest || certs[0].Certificate != opts.Certificate {
 		t.Fatalf("certificate data does not match expected values")
 	}
 }
+
+func TestSetRelationCertificateReplacesMatchingEntry(t *testing.T) {
+	renewed := issueTestCertificate(t, "certificates:0", "a.example.com")
+	other := issueTestCertificate(t, "certificates:0", "b.example.com")
+
+	existing, err := json.Marshal([]certificates.CertificateSigningRequestProviderAppRelationData{
+		{CA: "test-ca", Chain: []string{"cert-a", "test-ca"}, CertificateSigningRequest: renewed.CertificateSigningRequest, Certificate: "cert-a"},
+		{CA: other.CA, Chain: other.Chain, CertificateSigningRequest: other.CertificateSigningRequest, Certificate: other.Certificate},
+	})
+	if err != nil {
+		t.Fatalf("failed to marshal existing certificates: %v", err)
+	}
+
+	ctx := goopstest.NewContext(
+		func() error { return SetRelationCertificateExampleUse(renewed) },
+	)
+
+	certificatesRelation := goopstest.Relation{
+		Endpoint: "certificates",
+		LocalAppData: goopstest.DataBag{
+			"certificates": string(existing),
+		},
+	}
+
+	stateIn := goopstest.State{
+		Leader: true,
+		Relations: []goopstest.Relation{
+			certificatesRelation,
+		},
+	}
+
+	stateOut := ctx.Run("start", stateIn)
+
+	if ctx.CharmErr != nil {
+		t.Fatalf("charm error: %v", ctx.CharmErr)
+	}
+
+	var certs []certificates.CertificateSigningRequestProviderAppRelationData
+
+	err = json.Unmarshal([]byte(stateOut.Relations[0].LocalAppData["certificates"]), &certs)
+	if err != nil {
+		t.Fatalf("failed to unmarshal relation data: %v", err)
+	}
+
+	if len(certs) != 2 {
+		t.Fatalf("expected 2 certificates, got %d", len(certs))
+	}
+
+	if certs[0].CertificateSigningRequest != renewed.CertificateSigningRequest || certs[0].Certificate != renewed.Certificate {
+		t.Fatalf("expected the first certificate to be replaced, got %+v", certs[0])
+	}
+
+	if certs[1].CertificateSigningRequest != other.CertificateSigningRequest || certs[1].Certificate != other.Certificate {
+		t.Fatalf("expected the second certificate to be kept, got %+v", certs[1])
+	}
+}
+
+func SetRelationCertificatesExampleUse(opts []*certificates.SetRelationCertificateOptions) error {
+	ip := &certificates.IntegrationProvider{
+		RelationName: "certificates",
+	}
+
+	err := ip.SetRelationCertificates(opts)
+	if err != nil {
+		return fmt.Errorf("failed to set relation certificates: %w", err)
+	}
+
+	return nil
+}
+
+func TestSetRelationCertificates(t *testing.T) {
+	opts := []*certificates.SetRelationCertificateOptions{
+		issueTestCertificate(t, "certificates:0", "a.example.com"),
+		issueTestCertificate(t, "certificates:0", "b.example.com"),
+		issueTestCertificate(t, "certificates:1", "c.example.com"),
+	}
+
+	ctx := goopstest.NewContext(
+		func() error { return SetRelationCertificatesExampleUse(opts) },
+	)
+
+	stateIn := goopstest.State{
+		Leader: true,
+		Relations: []goopstest.Relation{
+			{
+				Endpoint: "certificates",
+			},
+			{
+				Endpoint: "certificates",
+			},
+		},
+	}
+
+	stateOut := ctx.Run("start", stateIn)
+
+	if ctx.CharmErr != nil {
+		t.Fatalf("charm error: %v", ctx.CharmErr)
+	}
+
+	expectedCounts := []int{2, 1}
+
+	for i, relation := range stateOut.Relations {
+		var certs []certificates.CertificateSigningRequestProviderAppRelationData
+
+		err := json.Unmarshal([]byte(relation.LocalAppData["certificates"]), &certs)
+		if err != nil {
+			t.Fatalf("failed to unmarshal relation data: %v", err)
+		}
+
+		if len(certs) != expectedCounts[i] {
+			t.Fatalf("expected %d certificates in relation %s, got %d", expectedCounts[i], relation.ID, len(certs))
+		}
+
+		for _, cert := range certs {
+			if cert.Chain == nil {
+				t.Fatalf("expected chain to be an empty list, got nil")
+			}
+		}
+	}
+}
+
+func GetOutstandingAppCertificateRequestsExampleUse() error {
+	ip := &certificates.IntegrationProvider{
+		RelationName: "certificates",
+	}
+
+	requirerRequests, _, err := ip.GetOutstandingCertificateRequests()
+	if err != nil {
+		return fmt.Errorf("failed to get outstanding certificate requests: %w", err)
+	}
+
+	if len(requirerRequests) != 2 {
+		return fmt.Errorf("expected 2 outstanding certificate requests, got %d", len(requirerRequests))
+	}
+
+	modes := map[certificates.Mode]int{}
+	for _, request := range requirerRequests {
+		modes[request.Mode]++
+	}
+
+	if modes[certificates.ModeUnit] != 1 || modes[certificates.ModeApp] != 1 {
+		return fmt.Errorf("expected 1 unit and 1 app certificate request, got %v", modes)
+	}
+
+	return nil
+}
+
+func TestGetOutstandingCertificateRequestsFromAppDataBag(t *testing.T) {
+	ctx := goopstest.NewContext(
+		GetOutstandingAppCertificateRequestsExampleUse,
+		goopstest.WithUnitID("provider/0"),
+		goopstest.WithAppName("provider"),
+	)
+
+	unitCSR, err := generateCSR()
+	if err != nil {
+		t.Fatalf("Failed to generate CSR: %v", err)
+	}
+
+	appCSR, err := generateCSR()
+	if err != nil {
+		t.Fatalf("Failed to generate CSR: %v", err)
+	}
+
+	unitRequestData, err := json.Marshal([]map[string]interface{}{{"certificate_signing_request": unitCSR}})
+	if err != nil {
+		t.Fatalf("Failed to marshal request data: %v", err)
+	}
+
+	appRequestData, err := json.Marshal([]map[string]interface{}{{"certificate_signing_request": appCSR}})
+	if err != nil {
+		t.Fatalf("Failed to marshal request data: %v", err)
+	}
+
+	certificatesRelation := goopstest.Relation{
+		Endpoint:      "certificates",
+		RemoteAppName: "requirer",
+		RemoteAppData: goopstest.DataBag{
+			"certificate_signing_requests": string(appRequestData),
+		},
+		RemoteUnitsData: map[goopstest.UnitID]goopstest.DataBag{
+			"requirer/0": {
+				"certificate_signing_requests": string(unitRequestData),
+			},
+		},
+	}
+
+	stateIn := goopstest.State{
+		Leader: true,
+		Relations: []goopstest.Relation{
+			certificatesRelation,
+		},
+	}
+
+	_ = ctx.Run("start", stateIn)
+
+	if ctx.CharmErr != nil {
+		t.Fatalf("charm error: %v", ctx.CharmErr)
+	}
+}
+
+func TestParseCertificate(t *testing.T) {
+	caPEM, caKeyPEM, err := certificates.GenerateCA(&certificates.GenerateCAOpts{
+		CommonName:       "Example CA",
+		ValidityDuration: 24 * time.Hour,
+		KeyAlgorithm:     certificates.KeyAlgorithmECDSAP384,
+	})
+	if err != nil {
+		t.Fatalf("failed to generate CA: %v", err)
+	}
+
+	certPEM, _, err := certificates.GenerateCertificate(&certificates.GenerateCertificateOpts{
+		CommonName:        "server.example.com",
+		Organization:      "Example Corp",
+		SANDNSNames:       []string{"server.example.com"},
+		SANIPAddresses:    []net.IP{net.ParseIP("10.0.0.1")},
+		ValidityDuration:  time.Hour,
+		KeyAlgorithm:      certificates.KeyAlgorithmRSA3072,
+		IssuerCertificate: caPEM,
+		IssuerPrivateKey:  caKeyPEM,
+	})
+	if err != nil {
+		t.Fatalf("failed to generate certificate: %v", err)
+	}
+
+	providerCertificate := &certificates.ProviderCertificate{
+		CA:          caPEM,
+		Chain:       []string{certPEM, caPEM},
+		Certificate: certPEM,
+	}
+
+	cert, err := providerCertificate.ParsedCertificate()
+	if err != nil {
+		t.Fatalf("failed to parse certificate: %v", err)
+	}
+
+	if cert.CommonName != "server.example.com" || cert.Organization != "Example Corp" {
+		t.Errorf("unexpected subject: %s, %s", cert.CommonName, cert.Organization)
+	}
+
+	if len(cert.SansIP) != 1 || cert.SansIP[0] != "10.0.0.1" {
+		t.Errorf("expected IP SAN 10.0.0.1, got %v", cert.SansIP)
+	}
+
+	if cert.Issuer != "CN=Example CA" {
+		t.Errorf("expected issuer 'CN=Example CA', got %q", cert.Issuer)
+	}
+
+	if cert.KeyAlgorithm != certificates.KeyAlgorithmRSA3072 {
+		t.Errorf("expected key algorithm %s, got %s", certificates.KeyAlgorithmRSA3072, cert.KeyAlgorithm)
+	}
+
+	if cert.IsCA || cert.SerialNumber == "" || len(cert.Fingerprint) != 95 {
+		t.Errorf("unexpected metadata: IsCA %v, serial %q, fingerprint %q", cert.IsCA, cert.SerialNumber, cert.Fingerprint)
+	}
+
+	if time.Until(cert.NotAfter) > time.Hour || cert.ExpiryTime != cert.NotAfter.UTC().Format(time.RFC3339) {
+		t.Errorf("unexpected expiry: %v, %s", cert.NotAfter, cert.ExpiryTime)
+	}
+
+	ca, err := providerCertificate.ParsedCA()
+	if err != nil {
+		t.Fatalf("failed to parse CA: %v", err)
+	}
+
+	if !ca.IsCA || ca.KeyAlgorithm != certificates.KeyAlgorithmECDSAP384 {
+		t.Errorf("expected an ECDSA P-384 CA, got IsCA %v, %s", ca.IsCA, ca.KeyAlgorithm)
+	}
+
+	chain, err := providerCertificate.ParsedChain()
+	if err != nil {
+		t.Fatalf("failed to parse chain: %v", err)
+	}
+
+	if len(chain) != 2 || chain[0].Fingerprint != cert.Fingerprint || chain[1].Fingerprint != ca.Fingerprint {
+		t.Errorf("expected the chain to hold the certificate then the CA")
+	}
+}
+
+func GetOutstandingCertificateRequestsWithFailuresExampleUse() error {
+	ip := &certificates.IntegrationProvider{
+		RelationName: "certificates",
+	}
+
+	requirerRequests, failures, err := ip.GetOutstandingCertificateRequests()
+	if err != nil {
+		return fmt.Errorf("failed to get outstanding certificate requests: %w", err)
+	}
+
+	if len(requirerRequests) != 2 {
+		return fmt.Errorf("expected 2 outstanding certificate requests, got %d", len(requirerRequests))
+	}
+
+	if len(failures) != 2 {
+		return fmt.Errorf("expected 2 failures, got %d", len(failures))
+	}
+
+	failuresByUnit := map[string]certificates.CertificateRequestFailure{}
+	for _, failure := range failures {
+		failuresByUnit[failure.Unit] = failure
+	}
+
+	badJSON, ok := failuresByUnit["requirer/1"]
+	if !ok || badJSON.RelationID != "certificates:0" || badJSON.CertificateSigningRequest != "" || badJSON.Err == nil {
+		return fmt.Errorf("unexpected failure for requirer/1: %+v", badJSON)
+	}
+
+	badCSR, ok := failuresByUnit["requirer/2"]
+	if !ok || badCSR.Mode != certificates.ModeUnit || badCSR.CertificateSigningRequest != "not a csr" || badCSR.Err == nil {
+		return fmt.Errorf("unexpected failure for requirer/2: %+v", badCSR)
+	}
+
+	return nil
+}
+
+func TestGetOutstandingCertificateRequestsWithFailures(t *testing.T) {
+	ctx := goopstest.NewContext(
+		GetOutstandingCertificateRequestsWithFailuresExampleUse,
+		goopstest.WithUnitID("provider/0"),
+		goopstest.WithAppName("provider"),
+	)
+
+	csr0, err := generateCSR()
+	if err != nil {
+		t.Fatalf("Failed to generate CSR: %v", err)
+	}
+
+	csr2, err := generateCSR()
+	if err != nil {
+		t.Fatalf("Failed to generate CSR: %v", err)
+	}
+
+	requestData0, err := json.Marshal([]map[string]interface{}{{"certificate_signing_request": csr0}})
+	if err != nil {
+		t.Fatalf("Failed to marshal request data: %v", err)
+	}
+
+	requestData2, err := json.Marshal([]map[string]interface{}{
+		{"certificate_signing_request": "not a csr"},
+		{"certificate_signing_request": csr2},
+	})
+	if err != nil {
+		t.Fatalf("Failed to marshal request data: %v", err)
+	}
+
+	stateIn := goopstest.State{
+		Leader: true,
+		Relations: []goopstest.Relation{
+			{
+				Endpoint:      "certificates",
+				RemoteAppName: "requirer",
+				RemoteUnitsData: map[goopstest.UnitID]goopstest.DataBag{
+					"requirer/0": {"certificate_signing_requests": string(requestData0)},
+					"requirer/1": {"certificate_signing_requests": "{not json"},
+					"requirer/2": {"certificate_signing_requests": string(requestData2)},
+				},
+			},
+		},
+	}
+
+	_ = ctx.Run("start", stateIn)
+
+	if ctx.CharmErr != nil {
+		t.Fatalf("charm error: %v", ctx.CharmErr)
+	}
+}
@@ -0,0 +1,177 @@
+package certificates
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/gruyaume/goops"
+)
+
+// DefaultRenewalLifetimeFraction is used when the requirer's RenewalPolicy is
+// empty: certificates are renewed once two thirds of their lifetime elapsed.
+const DefaultRenewalLifetimeFraction = 2.0 / 3.0
+
+// RenewalPolicy decides when an assigned certificate is renewed. When both
+// fields are set, the earliest of the two times wins.
+type RenewalPolicy struct {
+	// LifetimeFraction renews the certificate once this fraction of its
+	// lifetime elapsed, for example 0.75.
+	LifetimeFraction float64
+	// BeforeExpiry renews the certificate when less than this duration is
+	// left before it expires.
+	BeforeExpiry time.Duration
+}
+
+// RenewalTime returns when a certificate valid from notBefore to notAfter
+// should be renewed.
+func (r RenewalPolicy) RenewalTime(notBefore time.Time, notAfter time.Time) time.Time {
+	lifetimeFraction := r.LifetimeFraction
+	if lifetimeFraction == 0 && r.BeforeExpiry == 0 {
+		lifetimeFraction = DefaultRenewalLifetimeFraction
+	}
+
+	renewalTime := notAfter
+
+	if lifetimeFraction > 0 {
+		lifetime := notAfter.Sub(notBefore)
+		renewalTime = notBefore.Add(time.Duration(float64(lifetime) * lifetimeFraction))
+	}
+
+	if r.BeforeExpiry > 0 {
+		beforeExpiry := notAfter.Add(-r.BeforeExpiry)
+		if beforeExpiry.Before(renewalTime) {
+			renewalTime = beforeExpiry
+		}
+	}
+
+	return renewalTime
+}
+
+// RenewCertificates publishes a fresh certificate signing request, with the
+// same private key and attributes, for every assigned certificate that entered
+// its renewal window. It can be called from any hook and returns when the next
+// renewal check is due, or the zero time if no assigned certificate is waiting
+// for renewal.
+func (i *IntegrationRequirer) RenewCertificates() (time.Time, error) {
+	relationID, err := i.GetRelationID()
+	if err != nil {
+		return time.Time{}, fmt.Errorf("could not get relation ID: %v", err)
+	}
+
+	certificateRequests, err := i.certificateRequests()
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	canRequest, err := i.canRequest()
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	privateKey, err := i.GetPrivateKey()
+	if err != nil {
+		return time.Time{}, fmt.Errorf("could not get private key: %w", err)
+	}
+
+	published, err := providerPublished(relationID)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	if !published {
+		return time.Time{}, nil
+	}
+
+	providerCertificates, err := i.GetProviderCertificate()
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	var requestedCSRs []string
+	if canRequest {
+		requestedCSRs = i.getRequestedCertificateSigningRequests(relationID)
+	}
+
+	var nextCheck time.Time
+
+	renewed := false
+	now := time.Now()
+
+	for _, certificateRequest := range certificateRequests {
+		providerCertificate := findAssignedCertificate(providerCertificates, certificateRequest, privateKey)
+		if providerCertificate == nil {
+			continue
+		}
+
+		cert, err := parseCertificatePEM(providerCertificate.Certificate)
+		if err != nil {
+			goops.LogWarningf("Could not parse certificate for %q: %v", certificateRequest.Name, err)
+			continue
+		}
+
+		renewalTime := i.Renewal.RenewalTime(cert.NotBefore, cert.NotAfter)
+
+		if now.Before(renewalTime) || !canRequest {
+			if nextCheck.IsZero() || renewalTime.Before(nextCheck) {
+				nextCheck = renewalTime
+			}
+
+			continue
+		}
+
+		idx := indexOf(requestedCSRs, providerCertificate.CertificateSigningRequest)
+		if idx < 0 {
+			// The request was already renewed, the new certificate is not there yet.
+			continue
+		}
+
+		csr, err := generateCSR(privateKey, certificateRequest)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("could not renew CSR for %q: %w", certificateRequest.Name, err)
+		}
+
+		goops.LogInfof("Renewing certificate %q expiring at %s", certificateRequest.Name, cert.NotAfter.Format(time.RFC3339))
+
+		requestedCSRs[idx] = csr
+		renewed = true
+	}
+
+	if renewed {
+		err = i.setRequestedCertificateSigningRequests(relationID, requestedCSRs)
+		if err != nil {
+			return time.Time{}, err
+		}
+	}
+
+	return nextCheck, nil
+}
+
+// providerPublished tells whether the provider published any certificate on
+// the relation yet.
+func providerPublished(relationID string) (bool, error) {
+	relations, err := goops.ListRelationUnits(relationID)
+	if err != nil {
+		return false, fmt.Errorf("could not list relation units for ID %s: %v", relationID, err)
+	}
+
+	if len(relations) == 0 {
+		return false, nil
+	}
+
+	relationData, err := goops.GetAppRelationData(relationID, relations[0])
+	if err != nil {
+		return false, fmt.Errorf("could not get relation data: %w", err)
+	}
+
+	return relationData[certificatesKey] != "", nil
+}
+
+func indexOf(values []string, value string) int {
+	for idx, v := range values {
+		if v == value {
+			return idx
+		}
+	}
+
+	return -1
+}
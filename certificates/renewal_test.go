@@ -0,0 +1,273 @@
+package certificates_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/gruyaume/charm-libraries/certificates"
+	"github.com/gruyaume/goops/goopstest"
+)
+
+func TestRenewalTime(t *testing.T) {
+	notBefore := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	notAfter := notBefore.Add(90 * 24 * time.Hour)
+
+	tests := []struct {
+		name     string
+		policy   certificates.RenewalPolicy
+		expected time.Time
+	}{
+		{
+			name:     "default",
+			policy:   certificates.RenewalPolicy{},
+			expected: notBefore.Add(60 * 24 * time.Hour),
+		},
+		{
+			name:     "lifetime fraction",
+			policy:   certificates.RenewalPolicy{LifetimeFraction: 0.5},
+			expected: notBefore.Add(45 * 24 * time.Hour),
+		},
+		{
+			name:     "before expiry",
+			policy:   certificates.RenewalPolicy{BeforeExpiry: 7 * 24 * time.Hour},
+			expected: notAfter.Add(-7 * 24 * time.Hour),
+		},
+		{
+			name:     "earliest wins",
+			policy:   certificates.RenewalPolicy{LifetimeFraction: 0.9, BeforeExpiry: 30 * 24 * time.Hour},
+			expected: notAfter.Add(-30 * 24 * time.Hour),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			renewalTime := tt.policy.RenewalTime(notBefore, notAfter)
+			if !renewalTime.Equal(tt.expected) {
+				t.Fatalf("expected renewal time %s, got %s", tt.expected, renewalTime)
+			}
+		})
+	}
+}
+
+func renewCertificatesExampleUse(renewal certificates.RenewalPolicy, expectNextCheck bool) func() error {
+	return func() error {
+		integration := &certificates.IntegrationRequirer{
+			RelationName: "certificates",
+			CertificateRequests: []certificates.CertificateRequestAttributes{
+				{
+					Name:       "server",
+					CommonName: "server.example.com",
+					SansDNS:    []string{"server.example.com"},
+				},
+			},
+			Renewal: renewal,
+		}
+
+		nextCheck, err := integration.RenewCertificates()
+		if err != nil {
+			return fmt.Errorf("failed to renew certificates: %w", err)
+		}
+
+		if expectNextCheck == nextCheck.IsZero() {
+			return fmt.Errorf("unexpected next check time %s", nextCheck)
+		}
+
+		return nil
+	}
+}
+
+func renewalState(t *testing.T, csr string, privateKeyPEM string) goopstest.State {
+	t.Helper()
+
+	cert, _, err := certificates.GenerateCertificate(&certificates.GenerateCertificateOpts{
+		CommonName:       "server.example.com",
+		ValidityDuration: time.Hour,
+	})
+	if err != nil {
+		t.Fatalf("failed to generate certificate: %v", err)
+	}
+
+	csrs, err := json.Marshal([]map[string]string{
+		{"certificate_signing_request": csr, "ca": "false"},
+	})
+	if err != nil {
+		t.Fatalf("failed to marshal certificate signing requests: %v", err)
+	}
+
+	providerCertificates, err := json.Marshal([]certificates.ProviderCertificate{
+		{CA: cert, Chain: []string{cert}, CertificateSigningRequest: csr, Certificate: cert},
+	})
+	if err != nil {
+		t.Fatalf("failed to marshal provider certificates: %v", err)
+	}
+
+	return goopstest.State{
+		Relations: []goopstest.Relation{
+			{
+				Endpoint:      "certificates",
+				RemoteAppName: "provider",
+				LocalUnitData: goopstest.DataBag{
+					"certificate_signing_requests": string(csrs),
+				},
+				RemoteAppData: goopstest.DataBag{
+					"certificates": string(providerCertificates),
+				},
+				RemoteUnitsData: map[goopstest.UnitID]goopstest.DataBag{
+					"provider/0": {},
+				},
+			},
+		},
+		Secrets: []goopstest.Secret{
+			{
+				ID:      "private-key-secret",
+				Label:   certificates.PrivateKeySecretLabel,
+				Owner:   "unit",
+				Content: map[string]string{"private-key": privateKeyPEM},
+			},
+		},
+	}
+}
+
+func TestRenewCertificatesRenewsExpiringCertificate(t *testing.T) {
+	ctx := goopstest.NewContext(
+		renewCertificatesExampleUse(certificates.RenewalPolicy{BeforeExpiry: 2 * time.Hour}, false),
+	)
+
+	privateKey, privateKeyPEM := generatePrivateKeyPEM(t)
+	csr := generateCSRForKey(t, privateKey, "server.example.com")
+
+	stateOut := ctx.Run("update-status", renewalState(t, csr, privateKeyPEM))
+
+	if ctx.CharmErr != nil {
+		t.Fatalf("charm error: %v", ctx.CharmErr)
+	}
+
+	commonNames := parseRequestedCommonNames(t, stateOut.Relations[0].LocalUnitData["certificate_signing_requests"])
+
+	renewedCSR, ok := commonNames["server.example.com"]
+	if !ok {
+		t.Fatalf("expected a certificate signing request for the server certificate")
+	}
+
+	if renewedCSR == csr {
+		t.Fatalf("expected a fresh certificate signing request")
+	}
+}
+
+func TestRenewCertificatesRenewsAgain(t *testing.T) {
+	privateKey, privateKeyPEM := generatePrivateKeyPEM(t)
+	csr := generateCSRForKey(t, privateKey, "server.example.com")
+
+	for range 2 {
+		ctx := goopstest.NewContext(
+			renewCertificatesExampleUse(certificates.RenewalPolicy{BeforeExpiry: 2 * time.Hour}, false),
+		)
+
+		stateOut := ctx.Run("update-status", renewalState(t, csr, privateKeyPEM))
+
+		if ctx.CharmErr != nil {
+			t.Fatalf("charm error: %v", ctx.CharmErr)
+		}
+
+		commonNames := parseRequestedCommonNames(t, stateOut.Relations[0].LocalUnitData["certificate_signing_requests"])
+
+		renewedCSR := commonNames["server.example.com"]
+		if renewedCSR == "" || renewedCSR == csr {
+			t.Fatalf("expected a fresh certificate signing request")
+		}
+
+		csr = renewedCSR
+	}
+}
+
+func TestRenewCertificatesReportsNextCheck(t *testing.T) {
+	ctx := goopstest.NewContext(
+		renewCertificatesExampleUse(certificates.RenewalPolicy{}, true),
+	)
+
+	privateKey, privateKeyPEM := generatePrivateKeyPEM(t)
+	csr := generateCSRForKey(t, privateKey, "server.example.com")
+
+	stateOut := ctx.Run("update-status", renewalState(t, csr, privateKeyPEM))
+
+	if ctx.CharmErr != nil {
+		t.Fatalf("charm error: %v", ctx.CharmErr)
+	}
+
+	commonNames := parseRequestedCommonNames(t, stateOut.Relations[0].LocalUnitData["certificate_signing_requests"])
+
+	if commonNames["server.example.com"] != csr {
+		t.Fatalf("expected the certificate signing request not to change")
+	}
+}
+
+func TestRenewCertificatesNothingPublished(t *testing.T) {
+	ctx := goopstest.NewContext(
+		renewCertificatesExampleUse(certificates.RenewalPolicy{}, false),
+	)
+
+	privateKey, privateKeyPEM := generatePrivateKeyPEM(t)
+	csr := generateCSRForKey(t, privateKey, "server.example.com")
+
+	stateIn := renewalState(t, csr, privateKeyPEM)
+	stateIn.Relations[0].RemoteAppData = goopstest.DataBag{}
+
+	stateOut := ctx.Run("update-status", stateIn)
+
+	if ctx.CharmErr != nil {
+		t.Fatalf("charm error: %v", ctx.CharmErr)
+	}
+
+	commonNames := parseRequestedCommonNames(t, stateOut.Relations[0].LocalUnitData["certificate_signing_requests"])
+
+	if commonNames["server.example.com"] != csr {
+		t.Fatalf("expected the certificate signing request not to change")
+	}
+}
+
+func TestRenewCertificatesEd25519(t *testing.T) {
+	privateKeyPEM, err := certificates.GeneratePrivateKey(certificates.KeyAlgorithmEd25519)
+	if err != nil {
+		t.Fatalf("failed to generate private key: %v", err)
+	}
+
+	integration := &certificates.IntegrationRequirer{
+		RelationName: "certificates",
+		CertificateRequests: []certificates.CertificateRequestAttributes{
+			{
+				Name:       "server",
+				CommonName: "server.example.com",
+				SansDNS:    []string{"server.example.com"},
+			},
+		},
+	}
+
+	// Ed25519 signatures are deterministic, the CSR must be the one the
+	// library generates for the request.
+	requestCtx := goopstest.NewContext(integration.Request)
+
+	stateOut := requestCtx.Run("start", renewalState(t, "", privateKeyPEM))
+
+	if requestCtx.CharmErr != nil {
+		t.Fatalf("charm error: %v", requestCtx.CharmErr)
+	}
+
+	csr := parseRequestedCommonNames(t, stateOut.Relations[0].LocalUnitData["certificate_signing_requests"])["server.example.com"]
+
+	renewCtx := goopstest.NewContext(
+		renewCertificatesExampleUse(certificates.RenewalPolicy{BeforeExpiry: 2 * time.Hour}, false),
+	)
+
+	stateOut = renewCtx.Run("update-status", renewalState(t, csr, privateKeyPEM))
+
+	if renewCtx.CharmErr != nil {
+		t.Fatalf("charm error: %v", renewCtx.CharmErr)
+	}
+
+	renewedCSR := parseRequestedCommonNames(t, stateOut.Relations[0].LocalUnitData["certificate_signing_requests"])["server.example.com"]
+	if renewedCSR == "" || renewedCSR == csr {
+		t.Fatalf("expected a fresh certificate signing request")
+	}
+}
@@ -3,16 +3,14 @@ package certificates
 import (
 	"bytes"
 	"crypto/rand"
-	"crypto/rsa"
 	"crypto/x509"
 	"crypto/x509/pkix"
 	"encoding/asn1"
-	"encoding/json"
 	"encoding/pem"
 	"fmt"
 	"net"
-	"strconv"
-	"strings"
+	"slices"
+	"time"
 
 	"github.com/gruyaume/goops"
 )
@@ -21,7 +19,26 @@ const (
 	PrivateKeySecretLabel = "PRIVATE_KEY"
 )
 
+var oidExtensionSubjectAltName = asn1.ObjectIdentifier{2, 5, 29, 17}
+
+// Mode tells whether certificates are requested for each unit or once for the
+// whole application.
+type Mode string
+
+const (
+	// ModeUnit requests are published in the unit data bag and signed with a
+	// unit-owned private key.
+	ModeUnit Mode = "unit"
+	// ModeApp requests are published by the leader in the app data bag and
+	// signed with an app-owned private key, so every unit shares them.
+	ModeApp Mode = "app"
+)
+
 type CertificateRequestAttributes struct {
+	// Name identifies the request among the requirer's CertificateRequests.
+	// It is not part of the certificate signing request, so two requests
+	// must differ in at least one other attribute.
+	Name                string
 	CommonName          string
 	SansDNS             []string
 	SansIP              []string
@@ -35,8 +52,21 @@ type CertificateRequestAttributes struct {
 }
 
 type IntegrationRequirer struct {
-	RelationName       string
-	CertificateRequest CertificateRequestAttributes
+	RelationName string
+	// Deprecated: use CertificateRequests. CertificateRequest is only used
+	// when CertificateRequests is empty.
+	CertificateRequest  CertificateRequestAttributes
+	CertificateRequests []CertificateRequestAttributes
+	// Mode defaults to ModeUnit.
+	Mode Mode
+	// Renewal decides when RenewCertificates renews assigned certificates.
+	Renewal RenewalPolicy
+	// KeyAlgorithm is used for newly generated private keys and defaults to
+	// DefaultKeyAlgorithm.
+	KeyAlgorithm KeyAlgorithm
+	// PrivateKeySecretID is the ID of a user secret holding the private key
+	// under the "private-key" key. When set, no private key is generated.
+	PrivateKeySecretID string
 }
 
 type ProviderCertificate struct {
@@ -44,6 +74,48 @@ type ProviderCertificate struct {
 	Chain                     []string `json:"chain"`
 	CertificateSigningRequest string   `json:"certificate_signing_request"`
 	Certificate               string   `json:"certificate"`
+	Revoked                   bool     `json:"revoked,omitempty"`
+	// RecommendedExpiryNotificationTime is in hours before expiry.
+	RecommendedExpiryNotificationTime *int   `json:"recommended_expiry_notification_time,omitempty"`
+	ExpiryTime                        string `json:"expiry_time,omitempty"`
+}
+
+func newProviderCertificate(certificate CertificateV4) *ProviderCertificate {
+	return &ProviderCertificate{
+		CA:                                certificate.CA,
+		Chain:                             certificate.Chain,
+		CertificateSigningRequest:         certificate.CertificateSigningRequest,
+		Certificate:                       certificate.Certificate,
+		Revoked:                           certificate.Revoked,
+		RecommendedExpiryNotificationTime: certificate.RecommendedExpiryNotificationTime,
+		ExpiryTime:                        certificate.ExpiryTime,
+	}
+}
+
+// ParsedCertificate returns the parsed leaf certificate.
+func (pc *ProviderCertificate) ParsedCertificate() (Certificate, error) {
+	return ParseCertificate(pc.Certificate)
+}
+
+// ParsedCA returns the parsed CA certificate.
+func (pc *ProviderCertificate) ParsedCA() (Certificate, error) {
+	return ParseCertificate(pc.CA)
+}
+
+// ParsedChain returns every certificate of the chain, parsed, in order.
+func (pc *ProviderCertificate) ParsedChain() ([]Certificate, error) {
+	chain := make([]Certificate, 0, len(pc.Chain))
+
+	for i, certificatePEM := range pc.Chain {
+		cert, err := ParseCertificate(certificatePEM)
+		if err != nil {
+			return nil, fmt.Errorf("could not parse chain element %d: %w", i, err)
+		}
+
+		chain = append(chain, cert)
+	}
+
+	return chain, nil
 }
 
 func (i *IntegrationRequirer) GetRelationID() (string, error) {
@@ -59,14 +131,27 @@ func (i *IntegrationRequirer) GetRelationID() (string, error) {
 	return relationIDs[0], nil
 }
 
+// Request publishes one certificate signing request per entry of
+// CertificateRequests. Requests already published with the same attributes
+// are kept as they are, requests without a matching entry are dropped.
 func (i *IntegrationRequirer) Request() error {
 	relationID, err := i.GetRelationID()
 	if err != nil {
 		return fmt.Errorf("could not get relation ID: %v", err)
 	}
 
-	if i.certificateRequested() {
-		goops.LogInfof("Certificate already requested for relation ID %s", relationID)
+	certificateRequests, err := i.certificateRequests()
+	if err != nil {
+		return err
+	}
+
+	canRequest, err := i.canRequest()
+	if err != nil {
+		return err
+	}
+
+	if !canRequest {
+		goops.LogDebugf("Only the leader requests certificates in app mode")
 		return nil
 	}
 
@@ -75,26 +160,81 @@ func (i *IntegrationRequirer) Request() error {
 		return fmt.Errorf("could not get or generate private key: %w", err)
 	}
 
-	csr, err := i.generateCSR(privateKey)
+	err = i.requestWithPrivateKey(relationID, certificateRequests, privateKey)
 	if err != nil {
-		return fmt.Errorf("could not generate CSR: %w", err)
+		return err
 	}
 
-	csrMap := map[string]string{
-		"certificate_signing_request": csr,
-		"ca":                          "false",
+	i.completePrivateKeyRotation(certificateRequests, privateKey)
+
+	return nil
+}
+
+// requestWithPrivateKey publishes the CSRs of the certificate requests,
+// generating the ones that are missing with the private key.
+func (i *IntegrationRequirer) requestWithPrivateKey(relationID string, certificateRequests []CertificateRequestAttributes, privateKey string) error {
+	requestedCSRs := i.getRequestedCertificateSigningRequests(relationID)
+
+	csrs := make([]string, 0, len(certificateRequests))
+	changed := len(requestedCSRs) != len(certificateRequests)
+
+	for idx, certificateRequest := range certificateRequests {
+		var err error
+
+		csr := findCertificateSigningRequest(requestedCSRs, certificateRequest, privateKey)
+		if csr == "" {
+			csr, err = generateCSR(privateKey, certificateRequest)
+			if err != nil {
+				return fmt.Errorf("could not generate CSR: %w", err)
+			}
+		}
+
+		if idx >= len(requestedCSRs) || requestedCSRs[idx] != csr {
+			changed = true
+		}
+
+		csrs = append(csrs, csr)
+	}
+
+	if !changed {
+		goops.LogInfof("Certificates already requested for relation ID %s", relationID)
+		return nil
+	}
+
+	for _, requestedCSR := range requestedCSRs {
+		if !slices.Contains(csrs, requestedCSR) {
+			goops.LogInfof("Withdrawing a certificate signing request superseded by a change of the certificate requests")
+		}
+	}
+
+	return i.setRequestedCertificateSigningRequests(relationID, csrs)
+}
+
+// setRequestedCertificateSigningRequests publishes the CSRs in the unit data
+// bag, or in the app data bag in app mode.
+func (i *IntegrationRequirer) setRequestedCertificateSigningRequests(relationID string, csrs []string) error {
+	databag := RequirerDatabagV4{
+		CertificateSigningRequests: make([]CertificateSigningRequestV4, 0, len(csrs)),
+	}
+
+	for _, csr := range csrs {
+		databag.CertificateSigningRequests = append(databag.CertificateSigningRequests, CertificateSigningRequestV4{
+			CertificateSigningRequest: csr,
+			CA:                        false,
+		})
 	}
 
-	csrsBytes, err := json.Marshal([]map[string]string{csrMap})
+	relationData, err := databag.Dump()
 	if err != nil {
-		return fmt.Errorf("could not marshal scrape metadata to JSON: %w", err)
+		return err
 	}
 
-	relationData := map[string]string{
-		"certificate_signing_requests": string(csrsBytes),
+	if i.mode() == ModeApp {
+		err = goops.SetAppRelationData(relationID, relationData)
+	} else {
+		err = goops.SetUnitRelationData(relationID, relationData)
 	}
 
-	err = goops.SetUnitRelationData(relationID, relationData)
 	if err != nil {
 		return fmt.Errorf("could not set relation data: %w", err)
 	}
@@ -102,77 +242,359 @@ func (i *IntegrationRequirer) Request() error {
 	return nil
 }
 
-func (i *IntegrationRequirer) certificateRequested() bool {
-	relationID, err := i.GetRelationID()
+func (i *IntegrationRequirer) mode() Mode {
+	if i.Mode == "" {
+		return ModeUnit
+	}
+
+	return i.Mode
+}
+
+// canRequest tells whether this unit publishes certificate signing requests.
+// In app mode only the leader does.
+func (i *IntegrationRequirer) canRequest() (bool, error) {
+	if i.mode() != ModeApp {
+		return true, nil
+	}
+
+	isLeader, err := goops.IsLeader()
 	if err != nil {
-		goops.LogWarningf("Could not get relation ID: %v", err)
+		return false, fmt.Errorf("could not determine if unit is leader: %w", err)
+	}
+
+	return isLeader, nil
+}
+
+func (i *IntegrationRequirer) secretOwner() goops.SecretOwner {
+	if i.mode() == ModeApp {
+		return goops.OwnerApplication
+	}
+
+	return goops.OwnerUnit
+}
+
+// certificateRequests returns the requests the requirer should publish and
+// makes sure each of them can be told apart by its name.
+func (i *IntegrationRequirer) certificateRequests() ([]CertificateRequestAttributes, error) {
+	certificateRequests := i.CertificateRequests
+	if len(certificateRequests) == 0 {
+		certificateRequests = []CertificateRequestAttributes{i.CertificateRequest}
+	}
+
+	names := make(map[string]bool)
+
+	for index, certificateRequest := range certificateRequests {
+		if names[certificateRequest.Name] {
+			return nil, fmt.Errorf("certificate request name %q is not unique", certificateRequest.Name)
+		}
+
+		names[certificateRequest.Name] = true
+
+		// Requests are told apart by their attributes, so identical requests
+		// would share one CSR and one certificate.
+		for _, other := range certificateRequests[:index] {
+			if sameCertificateRequestAttributes(certificateRequest, other) {
+				return nil, fmt.Errorf("certificate requests %q and %q have the same attributes", other.Name, certificateRequest.Name)
+			}
+		}
+	}
+
+	return certificateRequests, nil
+}
+
+// sameCertificateRequestAttributes compares everything but the name. SANs are
+// compared as sets.
+func sameCertificateRequestAttributes(a CertificateRequestAttributes, b CertificateRequestAttributes) bool {
+	return a.CommonName == b.CommonName &&
+		a.EmailAddress == b.EmailAddress &&
+		a.Organization == b.Organization &&
+		a.OrganizationalUnit == b.OrganizationalUnit &&
+		a.CountryName == b.CountryName &&
+		a.StateOrProvinceName == b.StateOrProvinceName &&
+		a.LocalityName == b.LocalityName &&
+		sameStrings(a.SansDNS, b.SansDNS) &&
+		sameStrings(normalizeIPs(a.SansIP), normalizeIPs(b.SansIP)) &&
+		sameStrings(a.SansOID, b.SansOID)
+}
+
+func sameStrings(a []string, b []string) bool {
+	if len(a) != len(b) {
 		return false
 	}
 
+	sortedA := slices.Clone(a)
+	sortedB := slices.Clone(b)
+
+	slices.Sort(sortedA)
+	slices.Sort(sortedB)
+
+	return slices.Equal(sortedA, sortedB)
+}
+
+func (i *IntegrationRequirer) getCertificateRequest(name string) (CertificateRequestAttributes, error) {
+	certificateRequests, err := i.certificateRequests()
+	if err != nil {
+		return CertificateRequestAttributes{}, err
+	}
+
+	for _, certificateRequest := range certificateRequests {
+		if certificateRequest.Name == name {
+			return certificateRequest, nil
+		}
+	}
+
+	return CertificateRequestAttributes{}, fmt.Errorf("no certificate request named %q", name)
+}
+
+// getRequestedCertificateSigningRequests returns the CSRs currently published
+// in the unit data bag, or in the app data bag in app mode.
+func (i *IntegrationRequirer) getRequestedCertificateSigningRequests(relationID string) []string {
 	env := goops.ReadEnv()
 
-	relationData, err := goops.GetUnitRelationData(relationID, env.UnitName)
+	var (
+		relationData map[string]string
+		err          error
+	)
+
+	if i.mode() == ModeApp {
+		relationData, err = goops.GetAppRelationData(relationID, env.UnitName)
+	} else {
+		relationData, err = goops.GetUnitRelationData(relationID, env.UnitName)
+	}
+
+	if err != nil {
+		return nil
+	}
+
+	var databag RequirerDatabagV4
+
+	err = databag.Load(relationData)
 	if err != nil {
+		goops.LogWarningf("Could not load certificate signing requests: %v", err)
+		return nil
+	}
+
+	if len(databag.CertificateSigningRequests) == 0 {
+		return nil
+	}
+
+	csrs := make([]string, 0, len(databag.CertificateSigningRequests))
+
+	for _, certificateSigningRequest := range databag.CertificateSigningRequests {
+		csrs = append(csrs, certificateSigningRequest.CertificateSigningRequest)
+	}
+
+	return csrs
+}
+
+// findCertificateSigningRequest returns the CSR that was generated for the
+// certificate request with the given private key, or an empty string.
+func findCertificateSigningRequest(csrs []string, certificateRequest CertificateRequestAttributes, privateKey string) string {
+	for _, csr := range csrs {
+		if certificateRequested(csr, certificateRequest, privateKey) {
+			return csr
+		}
+	}
+
+	return ""
+}
+
+// certificateRequested tells whether the CSR was generated with the private
+// key for exactly the given certificate request attributes.
+func certificateRequested(csrPEM string, certificateRequest CertificateRequestAttributes, privateKey string) bool {
+	if csrPEM == "" {
 		return false
 	}
 
-	if relationData == nil {
+	csr, err := parseCertificateSigningRequestPEM(csrPEM)
+	if err != nil {
 		return false
 	}
 
-	certificateSigningRequestsStr := relationData["certificate_signing_requests"]
-	if certificateSigningRequestsStr == "" {
+	if !certificateSigningRequestMatches(csr, csrPEM, certificateRequest) {
 		return false
 	}
 
-	var certificateSigningRequests []map[string]string
+	return certificateSigningRequestSignedBy(csr, privateKey)
+}
 
-	err = json.Unmarshal([]byte(certificateSigningRequestsStr), &certificateSigningRequests)
+func certificateSigningRequestSignedBy(csr *x509.CertificateRequest, privateKey string) bool {
+	privKey, err := parsePrivateKeyPEM(privateKey)
 	if err != nil {
 		return false
 	}
 
-	if len(certificateSigningRequests) == 0 {
-		return false
+	return publicKeysEqual(privKey.Public(), csr.PublicKey)
+}
+
+// certificateSigningRequestMatches compares every certificate request
+// attribute with the CSR. SANs are compared as sets.
+func certificateSigningRequestMatches(csr *x509.CertificateRequest, csrPEM string, certificateRequest CertificateRequestAttributes) bool {
+	published := newCertificateSigningRequest(csrPEM, csr)
+
+	return published.CommonName == certificateRequest.CommonName &&
+		published.EmailAddress == certificateRequest.EmailAddress &&
+		published.Organization == certificateRequest.Organization &&
+		published.OrganizationalUnit == certificateRequest.OrganizationalUnit &&
+		published.CountryName == certificateRequest.CountryName &&
+		published.StateOrProvinceName == certificateRequest.StateOrProvinceName &&
+		published.LocalityName == certificateRequest.LocalityName &&
+		sameStrings(published.SansDNS, certificateRequest.SansDNS) &&
+		sameStrings(published.SansIP, normalizeIPs(certificateRequest.SansIP)) &&
+		sameStrings(published.SansOID, certificateRequest.SansOID)
+}
+
+// normalizeIPs returns the canonical form of the IP addresses, dropping the
+// ones that are not valid, the same way generateCSR does.
+func normalizeIPs(ips []string) []string {
+	normalized := make([]string, 0, len(ips))
+
+	for _, ipStr := range ips {
+		if ip := net.ParseIP(ipStr); ip != nil {
+			normalized = append(normalized, ip.String())
+		}
 	}
 
-	certificateSigningRequest := certificateSigningRequests[0]
+	return normalized
+}
 
-	if certificateSigningRequest["certificate_signing_request"] == "" {
-		return false
+// GetSupersededCertificates returns the certificates the provider issued for
+// CSRs signed with this requirer's private key that no longer match any
+// certificate request, because the requested attributes changed since. They
+// stay in the provider data until it prunes them and must not be used by the
+// workload anymore.
+func (i *IntegrationRequirer) GetSupersededCertificates() ([]*ProviderCertificate, error) {
+	certificateRequests, err := i.certificateRequests()
+	if err != nil {
+		return nil, err
 	}
 
-	block, _ := pem.Decode([]byte(certificateSigningRequest["certificate_signing_request"]))
-	if block == nil {
-		return false
+	privateKey, err := i.GetPrivateKey()
+	if err != nil {
+		return nil, fmt.Errorf("could not get private key: %w", err)
 	}
 
-	csr, err := x509.ParseCertificateRequest(block.Bytes)
+	providerCertificates, err := i.GetProviderCertificate()
 	if err != nil {
-		return false
+		return nil, err
 	}
 
-	if csr.Subject.CommonName != i.CertificateRequest.CommonName {
-		return false
+	superseded := make([]*ProviderCertificate, 0)
+
+	for _, providerCertificate := range providerCertificates {
+		csr, err := parseCertificateSigningRequestPEM(providerCertificate.CertificateSigningRequest)
+		if err != nil || !certificateSigningRequestSignedBy(csr, privateKey) {
+			continue
+		}
+
+		if findCertificateRequest(certificateRequests, csr, providerCertificate.CertificateSigningRequest) == nil {
+			superseded = append(superseded, providerCertificate)
+		}
 	}
 
-	if len(csr.DNSNames) != len(i.CertificateRequest.SansDNS) {
-		return false
+	return superseded, nil
+}
+
+func findCertificateRequest(certificateRequests []CertificateRequestAttributes, csr *x509.CertificateRequest, csrPEM string) *CertificateRequestAttributes {
+	for idx := range certificateRequests {
+		if certificateSigningRequestMatches(csr, csrPEM, certificateRequests[idx]) {
+			return &certificateRequests[idx]
+		}
+	}
+
+	return nil
+}
+
+// GetAssignedCertificate returns the certificate the provider issued for the
+// certificate request with the given name. The provider's entries are matched
+// against the request attributes and the private key, so this works for every
+// unit in app mode, not only for the leader that published the request.
+func (i *IntegrationRequirer) GetAssignedCertificate(name string) (*ProviderCertificate, error) {
+	certificateRequest, err := i.getCertificateRequest(name)
+	if err != nil {
+		return nil, err
 	}
 
 	privateKey, err := i.GetPrivateKey()
 	if err != nil {
-		return false
+		return nil, fmt.Errorf("could not get private key: %w", err)
+	}
+
+	providerCertificates, err := i.GetProviderCertificate()
+	if err != nil {
+		return nil, err
+	}
+
+	providerCertificate := findAssignedCertificate(providerCertificates, certificateRequest, privateKey)
+	if providerCertificate != nil {
+		return providerCertificate, nil
+	}
+
+	// While the private key is rotated, the certificate issued for the
+	// previous key is still the one to use.
+	previousPrivateKey, err := i.getPreviousPrivateKey()
+	if err == nil && previousPrivateKey != "" {
+		providerCertificate = findAssignedCertificate(providerCertificates, certificateRequest, previousPrivateKey)
+	}
+
+	if providerCertificate == nil {
+		return nil, fmt.Errorf("no certificate assigned for %q", name)
+	}
+
+	return providerCertificate, nil
+}
+
+// findAssignedCertificate returns the provider certificate issued for the
+// certificate request. Revoked certificates are skipped. While a renewal is in
+// flight the provider may list both the old and the new certificate, the one
+// expiring last wins.
+func findAssignedCertificate(providerCertificates []*ProviderCertificate, certificateRequest CertificateRequestAttributes, privateKey string) *ProviderCertificate {
+	return findLatestCertificate(providerCertificates, certificateRequest, privateKey, false)
+}
+
+// findLatestCertificate returns the provider certificate issued for the
+// certificate request that expires last, revoked or not as asked.
+func findLatestCertificate(providerCertificates []*ProviderCertificate, certificateRequest CertificateRequestAttributes, privateKey string, includeRevoked bool) *ProviderCertificate {
+	var (
+		assigned         *ProviderCertificate
+		assignedNotAfter time.Time
+	)
+
+	for _, providerCertificate := range providerCertificates {
+		if providerCertificate.Revoked && !includeRevoked {
+			continue
+		}
+
+		if !certificateRequested(providerCertificate.CertificateSigningRequest, certificateRequest, privateKey) {
+			continue
+		}
+
+		var notAfter time.Time
+		if cert, err := parseCertificatePEM(providerCertificate.Certificate); err == nil {
+			notAfter = cert.NotAfter
+		}
+
+		if assigned == nil || notAfter.After(assignedNotAfter) {
+			assigned = providerCertificate
+			assignedNotAfter = notAfter
+		}
 	}
 
-	block, _ = pem.Decode([]byte(privateKey))
+	return assigned
+}
+
+func parseCertificatePEM(certificatePEM string) (*x509.Certificate, error) {
+	block, _ := pem.Decode([]byte(certificatePEM))
 	if block == nil {
-		return false
+		return nil, fmt.Errorf("failed to decode PEM block containing the certificate")
 	}
 
-	err = csr.CheckSignature()
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse certificate: %w", err)
+	}
 
-	return err == nil
+	return cert, nil
 }
 
 func (i *IntegrationRequirer) GetProviderCertificate() ([]*ProviderCertificate, error) {
@@ -199,22 +621,30 @@ func (i *IntegrationRequirer) GetProviderCertificate() ([]*ProviderCertificate,
 		return nil, fmt.Errorf("relation data is empty")
 	}
 
-	certificatesStr := relationData["certificates"]
-	if certificatesStr == "" {
+	if relationData[certificatesKey] == "" {
 		return nil, fmt.Errorf("no certificates found in relation data")
 	}
 
-	var providerCertificate []*ProviderCertificate
+	var databag ProviderDatabagV4
 
-	err = json.Unmarshal([]byte(certificatesStr), &providerCertificate)
+	err = databag.Load(relationData)
 	if err != nil {
 		return nil, fmt.Errorf("failed to unmarshal provider certificate: %w", err)
 	}
 
-	return providerCertificate, nil
+	providerCertificates := make([]*ProviderCertificate, 0, len(databag.Certificates))
+	for _, certificate := range databag.Certificates {
+		providerCertificates = append(providerCertificates, newProviderCertificate(certificate))
+	}
+
+	return providerCertificates, nil
 }
 
 func (i *IntegrationRequirer) GetPrivateKey() (string, error) {
+	if i.PrivateKeySecretID != "" {
+		return i.getUserPrivateKey()
+	}
+
 	secret, err := goops.GetSecretByLabel(PrivateKeySecretLabel, false, true)
 	if err != nil {
 		return "", fmt.Errorf("cCould not get private key secret: %v", err)
@@ -228,6 +658,10 @@ func (i *IntegrationRequirer) GetPrivateKey() (string, error) {
 }
 
 func (i *IntegrationRequirer) getOrGeneratePrivateKey() (string, error) {
+	if i.PrivateKeySecretID != "" {
+		return i.getUserPrivateKey()
+	}
+
 	secret, _ := goops.GetSecretByLabel(PrivateKeySecretLabel, false, true)
 
 	if secret != nil {
@@ -236,26 +670,18 @@ func (i *IntegrationRequirer) getOrGeneratePrivateKey() (string, error) {
 
 	goops.LogWarningf("Secret is empty")
 
-	priv, err := rsa.GenerateKey(rand.Reader, 2048)
+	privateKey, err := GeneratePrivateKey(i.KeyAlgorithm)
 	if err != nil {
-		return "", fmt.Errorf("failed to generate private key: %w", err)
+		return "", err
 	}
 
 	goops.LogWarningf("Generated new private key")
 
-	keyBuf := &bytes.Buffer{}
-	privBytes := x509.MarshalPKCS1PrivateKey(priv)
-
-	err = pem.Encode(keyBuf, &pem.Block{Type: "RSA PRIVATE KEY", Bytes: privBytes})
-	if err != nil {
-		return "", fmt.Errorf("failed to PEM‐encode private key: %w", err)
-	}
-
 	secretAddOpts := &goops.AddSecretOptions{
-		Owner: goops.OwnerUnit,
+		Owner: i.secretOwner(),
 		Label: PrivateKeySecretLabel,
 		Content: map[string]string{
-			"private-key": keyBuf.String(),
+			"private-key": privateKey,
 		},
 	}
 
@@ -264,57 +690,65 @@ func (i *IntegrationRequirer) getOrGeneratePrivateKey() (string, error) {
 		return "", fmt.Errorf("could not add secret: %w", err)
 	}
 
-	return keyBuf.String(), nil
+	return privateKey, nil
 }
 
-func (i *IntegrationRequirer) generateCSR(privateKeyPEM string) (string, error) {
-	block, _ := pem.Decode([]byte(privateKeyPEM))
-	if block == nil {
-		return "", fmt.Errorf("failed to PEM decode private key")
+func generateCSR(privateKeyPEM string, certificateRequest CertificateRequestAttributes) (string, error) {
+	privKey, err := parsePrivateKeyPEM(privateKeyPEM)
+	if err != nil {
+		return "", err
 	}
 
-	privKey, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+	uniqueIdentifier, err := newUniqueIdentifier()
 	if err != nil {
-		return "", fmt.Errorf("could not parse private key: %v", err)
+		return "", err
 	}
 
 	template := x509.CertificateRequest{
 		Subject: pkix.Name{
-			CommonName:         i.CertificateRequest.CommonName,
-			Organization:       []string{i.CertificateRequest.Organization},
-			OrganizationalUnit: []string{i.CertificateRequest.OrganizationalUnit},
-			Country:            []string{i.CertificateRequest.CountryName},
-			Province:           []string{i.CertificateRequest.StateOrProvinceName},
-			Locality:           []string{i.CertificateRequest.LocalityName},
+			CommonName:         certificateRequest.CommonName,
+			Organization:       []string{certificateRequest.Organization},
+			OrganizationalUnit: []string{certificateRequest.OrganizationalUnit},
+			Country:            []string{certificateRequest.CountryName},
+			Province:           []string{certificateRequest.StateOrProvinceName},
+			Locality:           []string{certificateRequest.LocalityName},
+			// A random unique identifier makes every CSR distinct, so a
+			// renewal with the same key and attributes is a new request.
+			ExtraNames: []pkix.AttributeTypeAndValue{
+				{Type: oidX500UniqueIdentifier, Value: uniqueIdentifier},
+			},
 		},
-		DNSNames:       i.CertificateRequest.SansDNS,
-		EmailAddresses: []string{i.CertificateRequest.EmailAddress},
+		DNSNames: certificateRequest.SansDNS,
 	}
 
-	for _, ipStr := range i.CertificateRequest.SansIP {
+	for _, ipStr := range certificateRequest.SansIP {
 		if ip := net.ParseIP(ipStr); ip != nil {
 			template.IPAddresses = append(template.IPAddresses, ip)
 		}
 	}
 
-	for _, oidStr := range i.CertificateRequest.SansOID {
-		parts := strings.Split(oidStr, ".")
+	if certificateRequest.EmailAddress != "" {
+		template.EmailAddresses = []string{certificateRequest.EmailAddress}
+	}
 
-		var oid asn1.ObjectIdentifier
+	if len(certificateRequest.SansOID) > 0 {
+		oids := make([]asn1.ObjectIdentifier, 0, len(certificateRequest.SansOID))
 
-		for _, p := range parts {
-			v, err := strconv.Atoi(p)
+		for _, oidStr := range certificateRequest.SansOID {
+			oid, err := parseOID(oidStr)
 			if err != nil {
-				return "", fmt.Errorf("invalid OID %q: %w", oidStr, err)
+				return "", err
 			}
 
-			oid = append(oid, v)
+			oids = append(oids, oid)
 		}
 
-		template.ExtraExtensions = append(template.ExtraExtensions, pkix.Extension{
-			Id:    oid,
-			Value: nil, // if you need a specific value, marshal it here
-		})
+		sanExtension, err := marshalSubjectAltName(template.DNSNames, template.EmailAddresses, template.IPAddresses, nil, oids)
+		if err != nil {
+			return "", err
+		}
+
+		template.ExtraExtensions = append(template.ExtraExtensions, sanExtension)
 	}
 
 	derCSR, err := x509.CreateCertificateRequest(rand.Reader, &template, privKey)
@@ -329,3 +763,21 @@ func (i *IntegrationRequirer) generateCSR(privateKeyPEM string) (string, error)
 
 	return pemBuf.String(), nil
 }
+
+// oidX500UniqueIdentifier is the x500UniqueIdentifier attribute type.
+var oidX500UniqueIdentifier = asn1.ObjectIdentifier{2, 5, 4, 45}
+
+// newUniqueIdentifier returns a random version 4 UUID.
+func newUniqueIdentifier() (string, error) {
+	b := make([]byte, 16)
+
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate unique identifier: %w", err)
+	}
+
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:]), nil
+}
@@ -1,7 +1,10 @@
 package certificates_test
 
 import (
+	"crypto/rand"
+	"crypto/rsa"
 	"crypto/x509"
+	"crypto/x509/pkix"
 	"encoding/json"
 	"encoding/pem"
 	"fmt"
@@ -32,7 +35,7 @@ func RequestExampleUse() error {
 
 type RequirerRelationData struct {
 	CertificateSigningRequest string `json:"certificate_signing_request"`
-	CA                        string `json:"ca"`
+	CA                        bool   `json:"ca"`
 }
 
 func TestRequest(t *testing.T) {
@@ -76,8 +79,8 @@ func TestRequest(t *testing.T) {
 	if len(csrData) != 1 {
 		t.Fatalf("expected 1 certificate signing request, got %d", len(csrData))
 	}
-	if csrData[0].CA != "false" {
-		t.Fatalf("expected CA to be 'false', got '%s'", csrData[0].CA)
+	if csrData[0].CA {
+		t.Fatal("expected CA to be false, got true")
 	}
 
 	block, _ := pem.Decode([]byte(csrData[0].CertificateSigningRequest))
@@ -106,3 +109,505 @@ func TestRequest(t *testing.T) {
 		t.Fatalf("expected IPAddresses to be ['1.2.3.4'], got %v", csr.IPAddresses)
 	}
 }
+
+func MultipleRequestsExampleUse() error {
+	integration := &certificates.IntegrationRequirer{
+		RelationName: "certificates",
+		CertificateRequests: []certificates.CertificateRequestAttributes{
+			{
+				Name:       "server",
+				CommonName: "server.example.com",
+				SansDNS:    []string{"server.example.com"},
+			},
+			{
+				Name:       "client",
+				CommonName: "client.example.com",
+				SansDNS:    []string{"client.example.com"},
+			},
+		},
+	}
+
+	err := integration.Request()
+	if err != nil {
+		return fmt.Errorf("failed to request certificates: %w", err)
+	}
+
+	return nil
+}
+
+func generatePrivateKeyPEM(t *testing.T) (*rsa.PrivateKey, string) {
+	t.Helper()
+
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate private key: %v", err)
+	}
+
+	keyPEM := pem.EncodeToMemory(&pem.Block{
+		Type:  "RSA PRIVATE KEY",
+		Bytes: x509.MarshalPKCS1PrivateKey(privateKey),
+	})
+
+	return privateKey, string(keyPEM)
+}
+
+func generateCSRForKey(t *testing.T, privateKey *rsa.PrivateKey, commonName string) string {
+	t.Helper()
+
+	csrBytes, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: commonName},
+		DNSNames: []string{commonName},
+	}, privateKey)
+	if err != nil {
+		t.Fatalf("failed to create certificate request: %v", err)
+	}
+
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: csrBytes}))
+}
+
+func parseCSRBlock(block *pem.Block) (*x509.CertificateRequest, error) {
+	if block == nil || block.Type != "CERTIFICATE REQUEST" {
+		return nil, fmt.Errorf("failed to decode PEM block containing certificate request")
+	}
+
+	return x509.ParseCertificateRequest(block.Bytes)
+}
+
+func parseRequestedCommonNames(t *testing.T, relationData string) map[string]string {
+	t.Helper()
+
+	var csrData []*certificates.CertificateSigningRequestV4
+
+	if err := json.Unmarshal([]byte(relationData), &csrData); err != nil {
+		t.Fatalf("failed to unmarshal relation data: %v", err)
+	}
+
+	commonNames := make(map[string]string)
+
+	for _, data := range csrData {
+		block, _ := pem.Decode([]byte(data.CertificateSigningRequest))
+		if block == nil {
+			t.Fatalf("failed to decode PEM block containing certificate request")
+		}
+
+		csr, err := x509.ParseCertificateRequest(block.Bytes)
+		if err != nil {
+			t.Fatalf("failed to parse certificate signing request: %v", err)
+		}
+
+		commonNames[csr.Subject.CommonName] = data.CertificateSigningRequest
+	}
+
+	return commonNames
+}
+
+func TestRequestMultipleCertificates(t *testing.T) {
+	ctx := goopstest.NewContext(
+		MultipleRequestsExampleUse,
+	)
+
+	privateKey, privateKeyPEM := generatePrivateKeyPEM(t)
+	serverCSR := generateCSRForKey(t, privateKey, "server.example.com")
+	peerCSR := generateCSRForKey(t, privateKey, "peer.example.com")
+
+	csrs, err := json.Marshal([]map[string]string{
+		{"certificate_signing_request": serverCSR, "ca": "false"},
+		{"certificate_signing_request": peerCSR, "ca": "false"},
+	})
+	if err != nil {
+		t.Fatalf("failed to marshal certificate signing requests: %v", err)
+	}
+
+	stateIn := goopstest.State{
+		Relations: []goopstest.Relation{
+			{
+				Endpoint: "certificates",
+				LocalUnitData: goopstest.DataBag{
+					"certificate_signing_requests": string(csrs),
+				},
+			},
+		},
+		Secrets: []goopstest.Secret{
+			{
+				ID:      "private-key-secret",
+				Label:   certificates.PrivateKeySecretLabel,
+				Owner:   "unit",
+				Content: map[string]string{"private-key": privateKeyPEM},
+			},
+		},
+	}
+
+	stateOut := ctx.Run("start", stateIn)
+
+	if ctx.CharmErr != nil {
+		t.Fatalf("charm error: %v", ctx.CharmErr)
+	}
+
+	commonNames := parseRequestedCommonNames(t, stateOut.Relations[0].LocalUnitData["certificate_signing_requests"])
+
+	if len(commonNames) != 2 {
+		t.Fatalf("expected 2 certificate signing requests, got %d", len(commonNames))
+	}
+
+	if commonNames["server.example.com"] != serverCSR {
+		t.Fatalf("expected the server certificate signing request to be kept")
+	}
+
+	if _, ok := commonNames["client.example.com"]; !ok {
+		t.Fatalf("expected a certificate signing request for the client certificate")
+	}
+
+	if _, ok := commonNames["peer.example.com"]; ok {
+		t.Fatalf("expected the peer certificate signing request to be dropped")
+	}
+}
+
+func TestRequestRejectsIdenticalAttributes(t *testing.T) {
+	ctx := goopstest.NewContext(func() error {
+		integration := &certificates.IntegrationRequirer{
+			RelationName: "certificates",
+			CertificateRequests: []certificates.CertificateRequestAttributes{
+				{
+					Name:       "server",
+					CommonName: "example.com",
+					SansDNS:    []string{"example.com", "www.example.com"},
+				},
+				{
+					Name:       "backup",
+					CommonName: "example.com",
+					SansDNS:    []string{"www.example.com", "example.com"},
+				},
+			},
+		}
+
+		return integration.Request()
+	})
+
+	stateOut := ctx.Run("start", goopstest.State{
+		Relations: []goopstest.Relation{
+			{
+				Endpoint: "certificates",
+			},
+		},
+	})
+
+	if ctx.CharmErr == nil {
+		t.Fatalf("expected an error for certificate requests with the same attributes")
+	}
+
+	if len(stateOut.Relations[0].LocalUnitData) != 0 {
+		t.Fatalf("expected no certificate signing request to be published, got %v", stateOut.Relations[0].LocalUnitData)
+	}
+}
+
+func GetAssignedCertificateExampleUse() error {
+	integration := &certificates.IntegrationRequirer{
+		RelationName: "certificates",
+		CertificateRequests: []certificates.CertificateRequestAttributes{
+			{
+				Name:       "server",
+				CommonName: "server.example.com",
+				SansDNS:    []string{"server.example.com"},
+			},
+			{
+				Name:       "peer",
+				CommonName: "peer.example.com",
+				SansDNS:    []string{"peer.example.com"},
+			},
+		},
+	}
+
+	providerCertificate, err := integration.GetAssignedCertificate("peer")
+	if err != nil {
+		return fmt.Errorf("failed to get assigned certificate: %w", err)
+	}
+
+	if providerCertificate.Certificate != "peer-cert" {
+		return fmt.Errorf("expected certificate to be 'peer-cert', got '%s'", providerCertificate.Certificate)
+	}
+
+	return nil
+}
+
+func TestGetAssignedCertificate(t *testing.T) {
+	ctx := goopstest.NewContext(
+		GetAssignedCertificateExampleUse,
+	)
+
+	privateKey, privateKeyPEM := generatePrivateKeyPEM(t)
+	serverCSR := generateCSRForKey(t, privateKey, "server.example.com")
+	peerCSR := generateCSRForKey(t, privateKey, "peer.example.com")
+
+	csrs, err := json.Marshal([]map[string]string{
+		{"certificate_signing_request": serverCSR, "ca": "false"},
+		{"certificate_signing_request": peerCSR, "ca": "false"},
+	})
+	if err != nil {
+		t.Fatalf("failed to marshal certificate signing requests: %v", err)
+	}
+
+	providerCertificates, err := json.Marshal([]certificates.ProviderCertificate{
+		{CA: "test-ca", Chain: []string{"server-cert", "test-ca"}, CertificateSigningRequest: serverCSR, Certificate: "server-cert"},
+		{CA: "test-ca", Chain: []string{"peer-cert", "test-ca"}, CertificateSigningRequest: peerCSR, Certificate: "peer-cert"},
+	})
+	if err != nil {
+		t.Fatalf("failed to marshal provider certificates: %v", err)
+	}
+
+	stateIn := goopstest.State{
+		Relations: []goopstest.Relation{
+			{
+				Endpoint:      "certificates",
+				RemoteAppName: "provider",
+				LocalUnitData: goopstest.DataBag{
+					"certificate_signing_requests": string(csrs),
+				},
+				RemoteAppData: goopstest.DataBag{
+					"certificates": string(providerCertificates),
+				},
+				RemoteUnitsData: map[goopstest.UnitID]goopstest.DataBag{
+					"provider/0": {},
+				},
+			},
+		},
+		Secrets: []goopstest.Secret{
+			{
+				ID:      "private-key-secret",
+				Label:   certificates.PrivateKeySecretLabel,
+				Owner:   "unit",
+				Content: map[string]string{"private-key": privateKeyPEM},
+			},
+		},
+	}
+
+	_ = ctx.Run("start", stateIn)
+
+	if ctx.CharmErr != nil {
+		t.Fatalf("charm error: %v", ctx.CharmErr)
+	}
+}
+
+func AppModeRequestExampleUse() error {
+	integration := &certificates.IntegrationRequirer{
+		RelationName: "certificates",
+		Mode:         certificates.ModeApp,
+		CertificateRequests: []certificates.CertificateRequestAttributes{
+			{
+				Name:       "server",
+				CommonName: "example.com",
+				SansDNS:    []string{"example.com"},
+			},
+		},
+	}
+
+	err := integration.Request()
+	if err != nil {
+		return fmt.Errorf("failed to request certificate: %w", err)
+	}
+
+	return nil
+}
+
+func TestRequestAppMode(t *testing.T) {
+	ctx := goopstest.NewContext(
+		AppModeRequestExampleUse,
+	)
+
+	stateIn := goopstest.State{
+		Leader: true,
+		Relations: []goopstest.Relation{
+			{
+				Endpoint: "certificates",
+			},
+		},
+	}
+
+	stateOut := ctx.Run("start", stateIn)
+
+	if ctx.CharmErr != nil {
+		t.Fatalf("charm error: %v", ctx.CharmErr)
+	}
+
+	if _, ok := stateOut.Relations[0].LocalUnitData["certificate_signing_requests"]; ok {
+		t.Fatal("expected no certificate signing requests in the unit data bag")
+	}
+
+	commonNames := parseRequestedCommonNames(t, stateOut.Relations[0].LocalAppData["certificate_signing_requests"])
+	if _, ok := commonNames["example.com"]; !ok {
+		t.Fatalf("expected a certificate signing request in the app data bag")
+	}
+
+	if len(stateOut.Secrets) != 1 || stateOut.Secrets[0].Owner != "application" {
+		t.Fatalf("expected an app-owned private key secret, got %+v", stateOut.Secrets)
+	}
+}
+
+func TestRequestAppModeNonLeader(t *testing.T) {
+	ctx := goopstest.NewContext(
+		AppModeRequestExampleUse,
+	)
+
+	stateIn := goopstest.State{
+		Leader: false,
+		Relations: []goopstest.Relation{
+			{
+				Endpoint: "certificates",
+			},
+		},
+	}
+
+	stateOut := ctx.Run("start", stateIn)
+
+	if ctx.CharmErr != nil {
+		t.Fatalf("charm error: %v", ctx.CharmErr)
+	}
+
+	if len(stateOut.Relations[0].LocalAppData) != 0 {
+		t.Fatalf("expected a non-leader not to publish requests, got %v", stateOut.Relations[0].LocalAppData)
+	}
+
+	if len(stateOut.Secrets) != 0 {
+		t.Fatalf("expected a non-leader not to create a private key secret")
+	}
+}
+
+func ChangedAttributesExampleUse() error {
+	integration := &certificates.IntegrationRequirer{
+		RelationName: "certificates",
+		CertificateRequests: []certificates.CertificateRequestAttributes{
+			{
+				Name:       "server",
+				CommonName: "server.example.com",
+				SansDNS:    []string{"server.internal"},
+			},
+		},
+	}
+
+	err := integration.Request()
+	if err != nil {
+		return fmt.Errorf("failed to request certificate: %w", err)
+	}
+
+	superseded, err := integration.GetSupersededCertificates()
+	if err != nil {
+		return fmt.Errorf("failed to get superseded certificates: %w", err)
+	}
+
+	if len(superseded) != 1 || superseded[0].Certificate != "old-cert" {
+		return fmt.Errorf("expected the old certificate to be superseded, got %v", superseded)
+	}
+
+	return nil
+}
+
+func TestRequestReplacesCSRWhenAttributesChange(t *testing.T) {
+	ctx := goopstest.NewContext(
+		ChangedAttributesExampleUse,
+	)
+
+	privateKey, privateKeyPEM := generatePrivateKeyPEM(t)
+	oldCSR := generateCSRForKey(t, privateKey, "server.example.com")
+
+	csrs, err := json.Marshal([]map[string]string{
+		{"certificate_signing_request": oldCSR, "ca": "false"},
+	})
+	if err != nil {
+		t.Fatalf("failed to marshal certificate signing requests: %v", err)
+	}
+
+	providerCertificates, err := json.Marshal([]certificates.ProviderCertificate{
+		{CA: "test-ca", Chain: []string{"old-cert", "test-ca"}, CertificateSigningRequest: oldCSR, Certificate: "old-cert"},
+	})
+	if err != nil {
+		t.Fatalf("failed to marshal provider certificates: %v", err)
+	}
+
+	stateIn := goopstest.State{
+		Relations: []goopstest.Relation{
+			{
+				Endpoint:      "certificates",
+				RemoteAppName: "provider",
+				LocalUnitData: goopstest.DataBag{
+					"certificate_signing_requests": string(csrs),
+				},
+				RemoteAppData: goopstest.DataBag{
+					"certificates": string(providerCertificates),
+				},
+				RemoteUnitsData: map[goopstest.UnitID]goopstest.DataBag{
+					"provider/0": {},
+				},
+			},
+		},
+		Secrets: []goopstest.Secret{
+			{
+				ID:      "private-key-secret",
+				Label:   certificates.PrivateKeySecretLabel,
+				Owner:   "unit",
+				Content: map[string]string{"private-key": privateKeyPEM},
+			},
+		},
+	}
+
+	stateOut := ctx.Run("config-changed", stateIn)
+
+	if ctx.CharmErr != nil {
+		t.Fatalf("charm error: %v", ctx.CharmErr)
+	}
+
+	commonNames := parseRequestedCommonNames(t, stateOut.Relations[0].LocalUnitData["certificate_signing_requests"])
+
+	newCSR, ok := commonNames["server.example.com"]
+	if !ok {
+		t.Fatalf("expected a certificate signing request for the server certificate")
+	}
+
+	if newCSR == oldCSR {
+		t.Fatalf("expected the certificate signing request to be replaced")
+	}
+
+	block, _ := pem.Decode([]byte(newCSR))
+
+	csr, err := x509.ParseCertificateRequest(block.Bytes)
+	if err != nil {
+		t.Fatalf("failed to parse certificate signing request: %v", err)
+	}
+
+	if len(csr.DNSNames) != 1 || csr.DNSNames[0] != "server.internal" {
+		t.Fatalf("expected DNSNames to be ['server.internal'], got %v", csr.DNSNames)
+	}
+}
+
+func TestGetAssignedCertificateSkipsRevoked(t *testing.T) {
+	privateKey, privateKeyPEM := generatePrivateKeyPEM(t)
+	csrPEM := generateCSRForKey(t, privateKey, "server.example.com")
+
+	providerCertificates := []certificates.ProviderCertificate{
+		{CA: "test-ca", Chain: []string{"revoked-cert", "test-ca"}, CertificateSigningRequest: csrPEM, Certificate: "revoked-cert", Revoked: true},
+	}
+
+	ctx := goopstest.NewContext(func() error {
+		integration := &certificates.IntegrationRequirer{
+			RelationName: "certificates",
+			CertificateRequests: []certificates.CertificateRequestAttributes{
+				{
+					Name:       "server",
+					CommonName: "server.example.com",
+					SansDNS:    []string{"server.example.com"},
+				},
+			},
+		}
+
+		providerCertificate, err := integration.GetAssignedCertificate("server")
+		if err == nil {
+			return fmt.Errorf("expected no assigned certificate, got %q", providerCertificate.Certificate)
+		}
+
+		return nil
+	})
+
+	_ = ctx.Run("start", validatedCertificateState(t, privateKeyPEM, []string{csrPEM}, providerCertificates))
+
+	if ctx.CharmErr != nil {
+		t.Fatalf("charm error: %v", ctx.CharmErr)
+	}
+}
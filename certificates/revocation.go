@@ -0,0 +1,200 @@
+package certificates
+
+import (
+	"fmt"
+
+	"github.com/gruyaume/goops"
+)
+
+// RevokeCertificatesOptions selects the published certificates to revoke.
+// Exactly one of CertificateSigningRequest, SerialNumber and Unit is set.
+// SerialNumber is in decimal, as reported by ParseCertificate. Unit matches
+// the certificates answering the requests the unit publishes, so it must be
+// used while the unit data bag is still readable, for example in the
+// relation-departed hook. RelationID restricts the search to one relation.
+type RevokeCertificatesOptions struct {
+	RelationID                string
+	CertificateSigningRequest string
+	SerialNumber              string
+	Unit                      string
+	// Remove deletes the entries instead of marking them as revoked.
+	Remove bool
+}
+
+// RevokeCertificates marks the matching published certificates as revoked,
+// or removes them, and returns how many entries changed. It only changes the
+// relation data: certificates must also be revoked with the Revoker of their
+// issuer to appear in its CRL.
+func (p *IntegrationProvider) RevokeCertificates(opts *RevokeCertificatesOptions) (int, error) {
+	selectors := 0
+
+	for _, value := range []string{opts.CertificateSigningRequest, opts.SerialNumber, opts.Unit} {
+		if value != "" {
+			selectors++
+		}
+	}
+
+	if selectors != 1 {
+		return 0, fmt.Errorf("exactly one of certificate signing request, serial number and unit is required")
+	}
+
+	isLeader, err := goops.IsLeader()
+	if err != nil {
+		return 0, fmt.Errorf("could not determine if unit is leader: %w", err)
+	}
+
+	if !isLeader {
+		return 0, fmt.Errorf("unit is not the leader and cannot set app relation data")
+	}
+
+	relationIDs := []string{opts.RelationID}
+
+	if opts.RelationID == "" {
+		relationIDs, err = goops.GetRelationIDs(p.RelationName)
+		if err != nil {
+			return 0, fmt.Errorf("could not get relation IDs: %w", err)
+		}
+	}
+
+	changed := 0
+
+	for _, relationID := range relationIDs {
+		matches, err := revocationMatcher(relationID, opts)
+		if err != nil {
+			return changed, err
+		}
+
+		relationChanged, err := p.updateProviderCertificates(relationID, matches, opts.Remove)
+		if err != nil {
+			return changed, err
+		}
+
+		changed += relationChanged
+	}
+
+	return changed, nil
+}
+
+// PruneCertificates removes the published certificates whose certificate
+// signing request no requirer publishes anymore and returns how many were
+// removed. Certificates of a relation with an unreadable data bag are kept,
+// see GetCertificateRequestsStatus. Broken relations need no pruning, their
+// data bags go away with them.
+func (p *IntegrationProvider) PruneCertificates() (int, error) {
+	status, err := p.GetCertificateRequestsStatus(RenewalPolicy{})
+	if err != nil {
+		return 0, fmt.Errorf("could not get certificate requests status: %w", err)
+	}
+
+	relationIDs := make([]string, 0)
+	orphaned := make(map[string]map[string]bool)
+
+	for _, orphan := range status.Orphaned {
+		if _, ok := orphaned[orphan.RelationID]; !ok {
+			relationIDs = append(relationIDs, orphan.RelationID)
+			orphaned[orphan.RelationID] = make(map[string]bool)
+		}
+
+		orphaned[orphan.RelationID][orphan.Certificate.CertificateSigningRequest] = true
+	}
+
+	removed := 0
+
+	for _, relationID := range relationIDs {
+		csrs := orphaned[relationID]
+
+		relationRemoved, err := p.updateProviderCertificates(relationID, func(entry CertificateV4) bool {
+			return csrs[entry.CertificateSigningRequest]
+		}, true)
+		if err != nil {
+			return removed, err
+		}
+
+		removed += relationRemoved
+	}
+
+	if removed > 0 {
+		goops.LogInfof("Pruned %d certificates", removed)
+	}
+
+	return removed, nil
+}
+
+// revocationMatcher returns the function telling whether a published entry is
+// selected by the options.
+func revocationMatcher(relationID string, opts *RevokeCertificatesOptions) (func(CertificateV4) bool, error) {
+	switch {
+	case opts.CertificateSigningRequest != "":
+		return func(entry CertificateV4) bool {
+			return entry.CertificateSigningRequest == opts.CertificateSigningRequest
+		}, nil
+	case opts.SerialNumber != "":
+		return func(entry CertificateV4) bool {
+			cert, err := ParseCertificate(entry.Certificate)
+			return err == nil && cert.SerialNumber == opts.SerialNumber
+		}, nil
+	default:
+		relationData, err := goops.GetUnitRelationData(relationID, opts.Unit)
+		if err != nil {
+			return nil, fmt.Errorf("could not get relation data of %s: %w", opts.Unit, err)
+		}
+
+		var databag RequirerDatabagV4
+
+		err = databag.Load(relationData)
+		if err != nil {
+			return nil, fmt.Errorf("could not read certificate requests of %s: %w", opts.Unit, err)
+		}
+
+		csrs := make(map[string]bool, len(databag.CertificateSigningRequests))
+		for _, request := range databag.CertificateSigningRequests {
+			csrs[request.CertificateSigningRequest] = true
+		}
+
+		return func(entry CertificateV4) bool {
+			return csrs[entry.CertificateSigningRequest]
+		}, nil
+	}
+}
+
+// updateProviderCertificates marks the matching entries of a relation as
+// revoked, or removes them, and writes the data bag once if anything changed.
+func (p *IntegrationProvider) updateProviderCertificates(relationID string, matches func(CertificateV4) bool, remove bool) (int, error) {
+	appData, err := p.getProviderAppRelationData(relationID)
+	if err != nil {
+		return 0, fmt.Errorf("could not get provider app relation data: %w", err)
+	}
+
+	kept := make([]CertificateV4, 0, len(appData))
+	changed := 0
+
+	for _, entry := range appData {
+		if !matches(entry) {
+			kept = append(kept, entry)
+			continue
+		}
+
+		if remove {
+			changed++
+			continue
+		}
+
+		if !entry.Revoked {
+			entry.Revoked = true
+			changed++
+		}
+
+		kept = append(kept, entry)
+	}
+
+	if changed == 0 {
+		return 0, nil
+	}
+
+	err = p.setProviderAppRelationData(relationID, kept)
+	if err != nil {
+		return 0, err
+	}
+
+	return changed, nil
+}
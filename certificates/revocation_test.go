@@ -0,0 +1,235 @@
+package certificates_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/gruyaume/charm-libraries/certificates"
+	"github.com/gruyaume/goops/goopstest"
+)
+
+func RevokeCertificatesExampleUse(opts *certificates.RevokeCertificatesOptions, expected int) func() error {
+	return func() error {
+		ip := &certificates.IntegrationProvider{
+			RelationName: "certificates",
+		}
+
+		changed, err := ip.RevokeCertificates(opts)
+		if err != nil {
+			return fmt.Errorf("failed to revoke certificates: %w", err)
+		}
+
+		if changed != expected {
+			return fmt.Errorf("expected %d certificates to change, got %d", expected, changed)
+		}
+
+		return nil
+	}
+}
+
+func PruneCertificatesExampleUse() error {
+	ip := &certificates.IntegrationProvider{
+		RelationName: "certificates",
+	}
+
+	removed, err := ip.PruneCertificates()
+	if err != nil {
+		return fmt.Errorf("failed to prune certificates: %w", err)
+	}
+
+	if removed != 1 {
+		return fmt.Errorf("expected 1 certificate to be removed, got %d", removed)
+	}
+
+	return nil
+}
+
+type revocationFixture struct {
+	keptCSR  string
+	keptCert string
+	goneCSR  string
+	goneCert string
+}
+
+func newRevocationFixture(t *testing.T) revocationFixture {
+	t.Helper()
+
+	privateKey, _ := generatePrivateKeyPEM(t)
+	keptCSR := generateCSRForKey(t, privateKey, "kept.example.com")
+	goneCSR := generateCSRForKey(t, privateKey, "gone.example.com")
+	keptCert, _ := signWithNewCA(t, keptCSR)
+	goneCert, _ := signWithNewCA(t, goneCSR)
+
+	return revocationFixture{keptCSR: keptCSR, keptCert: keptCert, goneCSR: goneCSR, goneCert: goneCert}
+}
+
+// state publishes both certificates, requirer/0 requests the kept one and
+// requirer/1 the gone one, unless withdrawn is set.
+func (f revocationFixture) state(t *testing.T, withdrawn bool) goopstest.State {
+	t.Helper()
+
+	issuedData, err := json.Marshal([]certificates.CertificateV4{
+		{CA: "ca", Chain: []string{f.keptCert, "ca"}, CertificateSigningRequest: f.keptCSR, Certificate: f.keptCert},
+		{CA: "ca", Chain: []string{f.goneCert, "ca"}, CertificateSigningRequest: f.goneCSR, Certificate: f.goneCert},
+	})
+	if err != nil {
+		t.Fatalf("failed to marshal issued certificates: %v", err)
+	}
+
+	keptRequest, err := json.Marshal([]map[string]any{{"certificate_signing_request": f.keptCSR, "ca": false}})
+	if err != nil {
+		t.Fatalf("failed to marshal request data: %v", err)
+	}
+
+	goneRequest, err := json.Marshal([]map[string]any{{"certificate_signing_request": f.goneCSR, "ca": false}})
+	if err != nil {
+		t.Fatalf("failed to marshal request data: %v", err)
+	}
+
+	unitsData := map[goopstest.UnitID]goopstest.DataBag{
+		"requirer/0": {"certificate_signing_requests": string(keptRequest)},
+		"requirer/1": {"certificate_signing_requests": string(goneRequest)},
+	}
+
+	if withdrawn {
+		unitsData["requirer/1"] = goopstest.DataBag{}
+	}
+
+	return goopstest.State{
+		Leader: true,
+		Relations: []goopstest.Relation{
+			{
+				Endpoint:        "certificates",
+				RemoteAppName:   "requirer",
+				LocalAppData:    goopstest.DataBag{"certificates": string(issuedData)},
+				RemoteUnitsData: unitsData,
+			},
+		},
+	}
+}
+
+func publishedCertificates(t *testing.T, state goopstest.State) []certificates.CertificateV4 {
+	t.Helper()
+
+	var certs []certificates.CertificateV4
+
+	err := json.Unmarshal([]byte(state.Relations[0].LocalAppData["certificates"]), &certs)
+	if err != nil {
+		t.Fatalf("failed to unmarshal relation data: %v", err)
+	}
+
+	return certs
+}
+
+func TestRevokeCertificatesByCSR(t *testing.T) {
+	fixture := newRevocationFixture(t)
+
+	ctx := goopstest.NewContext(
+		RevokeCertificatesExampleUse(&certificates.RevokeCertificatesOptions{CertificateSigningRequest: fixture.goneCSR}, 1),
+		goopstest.WithUnitID("provider/0"),
+		goopstest.WithAppName("provider"),
+	)
+
+	stateOut := ctx.Run("start", fixture.state(t, false))
+
+	if ctx.CharmErr != nil {
+		t.Fatalf("charm error: %v", ctx.CharmErr)
+	}
+
+	certs := publishedCertificates(t, stateOut)
+	if len(certs) != 2 {
+		t.Fatalf("expected 2 certificates, got %d", len(certs))
+	}
+
+	for _, cert := range certs {
+		if cert.Revoked != (cert.CertificateSigningRequest == fixture.goneCSR) {
+			t.Errorf("unexpected revoked flag %t", cert.Revoked)
+		}
+	}
+}
+
+func TestRevokeCertificatesBySerialNumberRemoves(t *testing.T) {
+	fixture := newRevocationFixture(t)
+
+	parsed, err := certificates.ParseCertificate(fixture.goneCert)
+	if err != nil {
+		t.Fatalf("failed to parse certificate: %v", err)
+	}
+
+	ctx := goopstest.NewContext(
+		RevokeCertificatesExampleUse(&certificates.RevokeCertificatesOptions{SerialNumber: parsed.SerialNumber, Remove: true}, 1),
+		goopstest.WithUnitID("provider/0"),
+		goopstest.WithAppName("provider"),
+	)
+
+	stateOut := ctx.Run("start", fixture.state(t, false))
+
+	if ctx.CharmErr != nil {
+		t.Fatalf("charm error: %v", ctx.CharmErr)
+	}
+
+	certs := publishedCertificates(t, stateOut)
+	if len(certs) != 1 || certs[0].CertificateSigningRequest != fixture.keptCSR {
+		t.Fatalf("expected only the kept certificate, got %d certificates", len(certs))
+	}
+}
+
+func TestRevokeCertificatesByUnit(t *testing.T) {
+	fixture := newRevocationFixture(t)
+
+	ctx := goopstest.NewContext(
+		RevokeCertificatesExampleUse(&certificates.RevokeCertificatesOptions{RelationID: "certificates:0", Unit: "requirer/1"}, 1),
+		goopstest.WithUnitID("provider/0"),
+		goopstest.WithAppName("provider"),
+	)
+
+	stateOut := ctx.Run("certificates-relation-departed", fixture.state(t, false))
+
+	if ctx.CharmErr != nil {
+		t.Fatalf("charm error: %v", ctx.CharmErr)
+	}
+
+	for _, cert := range publishedCertificates(t, stateOut) {
+		if cert.Revoked != (cert.CertificateSigningRequest == fixture.goneCSR) {
+			t.Errorf("unexpected revoked flag %t", cert.Revoked)
+		}
+	}
+}
+
+func TestRevokeCertificatesRequiresOneSelector(t *testing.T) {
+	fixture := newRevocationFixture(t)
+
+	ctx := goopstest.NewContext(
+		RevokeCertificatesExampleUse(&certificates.RevokeCertificatesOptions{CertificateSigningRequest: fixture.goneCSR, Unit: "requirer/1"}, 1),
+		goopstest.WithUnitID("provider/0"),
+		goopstest.WithAppName("provider"),
+	)
+
+	_ = ctx.Run("start", fixture.state(t, false))
+
+	if ctx.CharmErr == nil {
+		t.Fatalf("expected charm error when several selectors are set")
+	}
+}
+
+func TestPruneCertificates(t *testing.T) {
+	fixture := newRevocationFixture(t)
+
+	ctx := goopstest.NewContext(
+		PruneCertificatesExampleUse,
+		goopstest.WithUnitID("provider/0"),
+		goopstest.WithAppName("provider"),
+	)
+
+	stateOut := ctx.Run("start", fixture.state(t, true))
+
+	if ctx.CharmErr != nil {
+		t.Fatalf("charm error: %v", ctx.CharmErr)
+	}
+
+	certs := publishedCertificates(t, stateOut)
+	if len(certs) != 1 || certs[0].CertificateSigningRequest != fixture.keptCSR {
+		t.Fatalf("expected only the kept certificate, got %d certificates", len(certs))
+	}
+}
@@ -0,0 +1,164 @@
+package certificates
+
+import (
+	"fmt"
+
+	"github.com/gruyaume/goops"
+)
+
+const previousPrivateKeySecretKey = "previous-private-key"
+
+// RotatePrivateKey replaces the private key and publishes new certificate
+// signing requests signed with it, withdrawing the ones signed with the
+// previous key. The previous key stays in the secret until the provider
+// issued a certificate for every request, so the workload keeps a valid
+// certificate and key pair meanwhile. Use GetPrivateKeyForCertificate to get
+// the key that goes with an assigned certificate.
+func (i *IntegrationRequirer) RotatePrivateKey() error {
+	relationID, err := i.GetRelationID()
+	if err != nil {
+		return fmt.Errorf("could not get relation ID: %v", err)
+	}
+
+	certificateRequests, err := i.certificateRequests()
+	if err != nil {
+		return err
+	}
+
+	canRequest, err := i.canRequest()
+	if err != nil {
+		return err
+	}
+
+	if !canRequest {
+		return fmt.Errorf("only the leader can rotate the private key in app mode")
+	}
+
+	if i.PrivateKeySecretID != "" {
+		return fmt.Errorf("the private key is supplied in secret %s and must be rotated there", i.PrivateKeySecretID)
+	}
+
+	secretID, err := i.getPrivateKeySecretID()
+	if err != nil {
+		return err
+	}
+
+	secret, err := goops.GetSecretByLabel(PrivateKeySecretLabel, false, true)
+	if err != nil {
+		return fmt.Errorf("could not get private key secret: %w", err)
+	}
+
+	// When a rotation is already in flight, the workload still uses the
+	// certificate of the previous key, so that is the one to keep.
+	previousPrivateKey := secret[previousPrivateKeySecretKey]
+	if previousPrivateKey == "" {
+		previousPrivateKey = secret["private-key"]
+	}
+
+	privateKey, err := GeneratePrivateKey(i.KeyAlgorithm)
+	if err != nil {
+		return err
+	}
+
+	err = goops.SetSecret(&goops.SetSecretOptions{
+		ID: secretID,
+		Content: map[string]string{
+			"private-key":               privateKey,
+			previousPrivateKeySecretKey: previousPrivateKey,
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("could not update private key secret: %w", err)
+	}
+
+	goops.LogInfof("Rotated private key, requesting new certificates")
+
+	return i.requestWithPrivateKey(relationID, certificateRequests, privateKey)
+}
+
+// GetPrivateKeyForCertificate returns the private key the certificate was
+// requested with. While the private key is rotated, this is the previous key
+// until the provider issued the new certificate.
+func (i *IntegrationRequirer) GetPrivateKeyForCertificate(providerCertificate *ProviderCertificate) (string, error) {
+	csr, err := parseCertificateSigningRequestPEM(providerCertificate.CertificateSigningRequest)
+	if err != nil {
+		return "", fmt.Errorf("could not parse certificate signing request: %w", err)
+	}
+
+	privateKey, err := i.GetPrivateKey()
+	if err != nil {
+		return "", fmt.Errorf("could not get private key: %w", err)
+	}
+
+	if certificateSigningRequestSignedBy(csr, privateKey) {
+		return privateKey, nil
+	}
+
+	previousPrivateKey, err := i.getPreviousPrivateKey()
+	if err == nil && previousPrivateKey != "" && certificateSigningRequestSignedBy(csr, previousPrivateKey) {
+		return previousPrivateKey, nil
+	}
+
+	return "", fmt.Errorf("certificate was not requested with this requirer's private key")
+}
+
+func (i *IntegrationRequirer) getPreviousPrivateKey() (string, error) {
+	secret, err := goops.GetSecretByLabel(PrivateKeySecretLabel, false, true)
+	if err != nil {
+		return "", fmt.Errorf("could not get private key secret: %w", err)
+	}
+
+	return secret[previousPrivateKeySecretKey], nil
+}
+
+func (i *IntegrationRequirer) getPrivateKeySecretID() (string, error) {
+	secretInfo, err := goops.GetSecretInfoByLabel(PrivateKeySecretLabel)
+	if err != nil {
+		return "", fmt.Errorf("could not get private key secret info: %w", err)
+	}
+
+	for secretID := range secretInfo {
+		return secretID, nil
+	}
+
+	return "", fmt.Errorf("private key secret not found")
+}
+
+// completePrivateKeyRotation drops the previous private key once the provider
+// issued a certificate for every request signed with the current one.
+func (i *IntegrationRequirer) completePrivateKeyRotation(certificateRequests []CertificateRequestAttributes, privateKey string) {
+	previousPrivateKey, err := i.getPreviousPrivateKey()
+	if err != nil || previousPrivateKey == "" {
+		return
+	}
+
+	providerCertificates, err := i.GetProviderCertificate()
+	if err != nil {
+		return
+	}
+
+	for _, certificateRequest := range certificateRequests {
+		if findAssignedCertificate(providerCertificates, certificateRequest, privateKey) == nil {
+			return
+		}
+	}
+
+	secretID, err := i.getPrivateKeySecretID()
+	if err != nil {
+		goops.LogWarningf("Could not complete private key rotation: %v", err)
+		return
+	}
+
+	err = goops.SetSecret(&goops.SetSecretOptions{
+		ID: secretID,
+		Content: map[string]string{
+			"private-key": privateKey,
+		},
+	})
+	if err != nil {
+		goops.LogWarningf("Could not complete private key rotation: %v", err)
+		return
+	}
+
+	goops.LogInfof("Private key rotation completed, dropped the previous private key")
+}
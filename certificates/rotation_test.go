@@ -0,0 +1,205 @@
+package certificates_test
+
+import (
+	"crypto/rsa"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"testing"
+
+	"github.com/gruyaume/charm-libraries/certificates"
+	"github.com/gruyaume/goops/goopstest"
+)
+
+func newRotationRequirer() *certificates.IntegrationRequirer {
+	return &certificates.IntegrationRequirer{
+		RelationName: "certificates",
+		CertificateRequests: []certificates.CertificateRequestAttributes{
+			{
+				Name:       "server",
+				CommonName: "server.example.com",
+				SansDNS:    []string{"server.example.com"},
+			},
+		},
+	}
+}
+
+func rotationState(t *testing.T, csr string, secretContent map[string]string) goopstest.State {
+	t.Helper()
+
+	csrs, err := json.Marshal([]map[string]string{
+		{"certificate_signing_request": csr, "ca": "false"},
+	})
+	if err != nil {
+		t.Fatalf("failed to marshal certificate signing requests: %v", err)
+	}
+
+	providerCertificates, err := json.Marshal([]certificates.ProviderCertificate{
+		{CA: "test-ca", Chain: []string{"server-cert", "test-ca"}, CertificateSigningRequest: csr, Certificate: "server-cert"},
+	})
+	if err != nil {
+		t.Fatalf("failed to marshal provider certificates: %v", err)
+	}
+
+	return goopstest.State{
+		Leader: true,
+		Relations: []goopstest.Relation{
+			{
+				Endpoint:      "certificates",
+				RemoteAppName: "provider",
+				LocalUnitData: goopstest.DataBag{
+					"certificate_signing_requests": string(csrs),
+				},
+				RemoteAppData: goopstest.DataBag{
+					"certificates": string(providerCertificates),
+				},
+				RemoteUnitsData: map[goopstest.UnitID]goopstest.DataBag{
+					"provider/0": {},
+				},
+			},
+		},
+		Secrets: []goopstest.Secret{
+			{
+				ID:      "private-key-secret",
+				Label:   certificates.PrivateKeySecretLabel,
+				Owner:   "unit",
+				Content: secretContent,
+			},
+		},
+	}
+}
+
+func RotatePrivateKeyExampleUse() error {
+	integration := newRotationRequirer()
+
+	err := integration.RotatePrivateKey()
+	if err != nil {
+		return fmt.Errorf("failed to rotate private key: %w", err)
+	}
+
+	return nil
+}
+
+func TestRotatePrivateKey(t *testing.T) {
+	ctx := goopstest.NewContext(
+		RotatePrivateKeyExampleUse,
+	)
+
+	privateKey, privateKeyPEM := generatePrivateKeyPEM(t)
+	oldCSR := generateCSRForKey(t, privateKey, "server.example.com")
+
+	stateOut := ctx.Run("rotate-private-key-action", rotationState(t, oldCSR, map[string]string{"private-key": privateKeyPEM}))
+
+	if ctx.CharmErr != nil {
+		t.Fatalf("charm error: %v", ctx.CharmErr)
+	}
+
+	content := stateOut.Secrets[0].Content
+
+	if content["previous-private-key"] != privateKeyPEM {
+		t.Fatalf("expected the previous private key to be kept")
+	}
+
+	if content["private-key"] == "" || content["private-key"] == privateKeyPEM {
+		t.Fatalf("expected a new private key")
+	}
+
+	commonNames := parseRequestedCommonNames(t, stateOut.Relations[0].LocalUnitData["certificate_signing_requests"])
+
+	newCSR, ok := commonNames["server.example.com"]
+	if !ok || newCSR == oldCSR {
+		t.Fatalf("expected a new certificate signing request")
+	}
+
+	block, _ := pem.Decode([]byte(newCSR))
+
+	csr, err := parseCSRBlock(block)
+	if err != nil {
+		t.Fatalf("failed to parse certificate signing request: %v", err)
+	}
+
+	if csr.PublicKey.(*rsa.PublicKey).Equal(&privateKey.PublicKey) {
+		t.Fatalf("expected the certificate signing request to be signed with the new private key")
+	}
+}
+
+func GetPrivateKeyForCertificateExampleUse(expectedPrivateKey string) func() error {
+	return func() error {
+		integration := newRotationRequirer()
+
+		providerCertificate, err := integration.GetAssignedCertificate("server")
+		if err != nil {
+			return fmt.Errorf("failed to get assigned certificate: %w", err)
+		}
+
+		privateKey, err := integration.GetPrivateKeyForCertificate(providerCertificate)
+		if err != nil {
+			return fmt.Errorf("failed to get private key for certificate: %w", err)
+		}
+
+		if privateKey != expectedPrivateKey {
+			return fmt.Errorf("expected the private key the certificate was requested with")
+		}
+
+		return nil
+	}
+}
+
+func TestGetPrivateKeyForCertificateDuringRotation(t *testing.T) {
+	previousPrivateKey, previousPrivateKeyPEM := generatePrivateKeyPEM(t)
+	_, privateKeyPEM := generatePrivateKeyPEM(t)
+	csr := generateCSRForKey(t, previousPrivateKey, "server.example.com")
+
+	ctx := goopstest.NewContext(
+		GetPrivateKeyForCertificateExampleUse(previousPrivateKeyPEM),
+	)
+
+	_ = ctx.Run("start", rotationState(t, csr, map[string]string{
+		"private-key":          privateKeyPEM,
+		"previous-private-key": previousPrivateKeyPEM,
+	}))
+
+	if ctx.CharmErr != nil {
+		t.Fatalf("charm error: %v", ctx.CharmErr)
+	}
+}
+
+func CompleteRotationExampleUse() error {
+	integration := newRotationRequirer()
+
+	err := integration.Request()
+	if err != nil {
+		return fmt.Errorf("failed to request certificate: %w", err)
+	}
+
+	return nil
+}
+
+func TestRequestCompletesPrivateKeyRotation(t *testing.T) {
+	ctx := goopstest.NewContext(
+		CompleteRotationExampleUse,
+	)
+
+	_, previousPrivateKeyPEM := generatePrivateKeyPEM(t)
+	privateKey, privateKeyPEM := generatePrivateKeyPEM(t)
+	csr := generateCSRForKey(t, privateKey, "server.example.com")
+
+	stateOut := ctx.Run("certificates-relation-changed", rotationState(t, csr, map[string]string{
+		"private-key":          privateKeyPEM,
+		"previous-private-key": previousPrivateKeyPEM,
+	}))
+
+	if ctx.CharmErr != nil {
+		t.Fatalf("charm error: %v", ctx.CharmErr)
+	}
+
+	content := stateOut.Secrets[0].Content
+
+	if content["private-key"] != privateKeyPEM {
+		t.Fatalf("expected the private key to be kept")
+	}
+
+	if _, ok := content["previous-private-key"]; ok {
+		t.Fatalf("expected the previous private key to be dropped")
+	}
+}
@@ -0,0 +1,135 @@
+package certificates
+
+import (
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// GeneralName tags of the subject alternative name extension, RFC 5280
+// section 4.2.1.6.
+const (
+	sanTagEmail        = 1
+	sanTagDNS          = 2
+	sanTagURI          = 6
+	sanTagIP           = 7
+	sanTagRegisteredID = 8
+)
+
+// marshalSubjectAltName builds the subject alternative name extension
+// itself, as the standard library cannot encode registered IDs.
+func marshalSubjectAltName(dnsNames []string, emailAddresses []string, ipAddresses []net.IP, uris []*url.URL, oids []asn1.ObjectIdentifier) (pkix.Extension, error) {
+	var rawValues []asn1.RawValue
+
+	for _, name := range dnsNames {
+		rawValues = append(rawValues, asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: sanTagDNS, Bytes: []byte(name)})
+	}
+
+	for _, email := range emailAddresses {
+		rawValues = append(rawValues, asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: sanTagEmail, Bytes: []byte(email)})
+	}
+
+	for _, ip := range ipAddresses {
+		if ip4 := ip.To4(); ip4 != nil {
+			ip = ip4
+		}
+
+		rawValues = append(rawValues, asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: sanTagIP, Bytes: ip})
+	}
+
+	for _, uri := range uris {
+		rawValues = append(rawValues, asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: sanTagURI, Bytes: []byte(uri.String())})
+	}
+
+	for _, oid := range oids {
+		der, err := asn1.Marshal(oid)
+		if err != nil {
+			return pkix.Extension{}, fmt.Errorf("failed to marshal OID %s: %w", oid, err)
+		}
+
+		var encoded asn1.RawValue
+
+		_, err = asn1.Unmarshal(der, &encoded)
+		if err != nil {
+			return pkix.Extension{}, fmt.Errorf("failed to unmarshal OID %s: %w", oid, err)
+		}
+
+		rawValues = append(rawValues, asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: sanTagRegisteredID, Bytes: encoded.Bytes})
+	}
+
+	value, err := asn1.Marshal(rawValues)
+	if err != nil {
+		return pkix.Extension{}, fmt.Errorf("failed to marshal subject alternative name: %w", err)
+	}
+
+	return pkix.Extension{Id: oidExtensionSubjectAltName, Value: value}, nil
+}
+
+// parseSubjectAltNameOIDs returns the registered IDs of the subject
+// alternative name extension, which the standard library skips.
+func parseSubjectAltNameOIDs(extensions []pkix.Extension) ([]string, error) {
+	oids := make([]string, 0)
+
+	for _, extension := range extensions {
+		if !extension.Id.Equal(oidExtensionSubjectAltName) {
+			continue
+		}
+
+		var rawValues []asn1.RawValue
+
+		rest, err := asn1.Unmarshal(extension.Value, &rawValues)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse subject alternative name: %w", err)
+		}
+
+		if len(rest) != 0 {
+			return nil, fmt.Errorf("trailing data after subject alternative name")
+		}
+
+		for _, rawValue := range rawValues {
+			if rawValue.Class != asn1.ClassContextSpecific || rawValue.Tag != sanTagRegisteredID {
+				continue
+			}
+
+			der, err := asn1.Marshal(asn1.RawValue{Class: asn1.ClassUniversal, Tag: asn1.TagOID, Bytes: rawValue.Bytes})
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse registered ID: %w", err)
+			}
+
+			var oid asn1.ObjectIdentifier
+
+			_, err = asn1.Unmarshal(der, &oid)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse registered ID: %w", err)
+			}
+
+			oids = append(oids, oid.String())
+		}
+	}
+
+	return oids, nil
+}
+
+func parseOID(oidStr string) (asn1.ObjectIdentifier, error) {
+	parts := strings.Split(oidStr, ".")
+	if len(parts) < 2 {
+		return nil, fmt.Errorf("invalid OID %q: need at least two arcs", oidStr)
+	}
+
+	oid := make(asn1.ObjectIdentifier, 0, len(parts))
+
+	for _, p := range parts {
+		v, err := strconv.Atoi(p)
+		if err != nil || v < 0 {
+			return nil, fmt.Errorf("invalid OID %q: %q is not an arc", oidStr, p)
+		}
+
+		oid = append(oid, v)
+	}
+
+	return oid, nil
+}
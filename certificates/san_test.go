@@ -0,0 +1,267 @@
+package certificates_test
+
+import (
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/gruyaume/charm-libraries/certificates"
+	"github.com/gruyaume/goops/goopstest"
+)
+
+func OIDSansRequestExampleUse() error {
+	integration := &certificates.IntegrationRequirer{
+		RelationName: "certificates",
+		CertificateRequest: certificates.CertificateRequestAttributes{
+			CommonName:   "example.com",
+			EmailAddress: "admin@example.com",
+			SansDNS:      []string{"example.com"},
+			SansIP:       []string{"1.2.3.4"},
+			SansOID:      []string{"1.3.6.1.4.1.28978.1"},
+		},
+	}
+
+	err := integration.Request()
+	if err != nil {
+		return fmt.Errorf("failed to request certificate: %w", err)
+	}
+
+	return nil
+}
+
+func GetOutstandingOIDSansExampleUse() error {
+	ip := &certificates.IntegrationProvider{
+		RelationName: "certificates",
+	}
+
+	requests, _, err := ip.GetOutstandingCertificateRequests()
+	if err != nil {
+		return fmt.Errorf("failed to get outstanding certificate requests: %w", err)
+	}
+
+	if len(requests) != 1 {
+		return fmt.Errorf("expected 1 outstanding certificate request, got %d", len(requests))
+	}
+
+	if !slices.Equal(requests[0].CertificateSigningRequest.SansOID, []string{"1.3.6.1.4.1.28978.1"}) {
+		return fmt.Errorf("expected OID SAN 1.3.6.1.4.1.28978.1, got %v", requests[0].CertificateSigningRequest.SansOID)
+	}
+
+	ca := &certificates.CertificateAuthority{
+		CommonName: "Example CA",
+	}
+
+	return ip.SignOutstandingCertificateRequests(ca)
+}
+
+func TestOIDSansRoundTrip(t *testing.T) {
+	requirerCtx := goopstest.NewContext(
+		OIDSansRequestExampleUse,
+	)
+
+	requirerStateIn := goopstest.State{
+		Relations: []goopstest.Relation{
+			{
+				Endpoint: "certificates",
+			},
+		},
+	}
+
+	requirerStateOut := requirerCtx.Run("start", requirerStateIn)
+
+	if requirerCtx.CharmErr != nil {
+		t.Fatalf("requirer charm error: %v", requirerCtx.CharmErr)
+	}
+
+	var csrData []*RequirerRelationData
+
+	err := json.Unmarshal([]byte(requirerStateOut.Relations[0].LocalUnitData["certificate_signing_requests"]), &csrData)
+	if err != nil {
+		t.Fatalf("failed to unmarshal relation data: %v", err)
+	}
+
+	csrPEM := csrData[0].CertificateSigningRequest
+
+	csr := parseCSR(t, csrPEM)
+
+	if !slices.Equal(csr.DNSNames, []string{"example.com"}) ||
+		len(csr.IPAddresses) != 1 || csr.IPAddresses[0].String() != "1.2.3.4" ||
+		!slices.Equal(csr.EmailAddresses, []string{"admin@example.com"}) {
+		t.Fatalf("expected the other SANs to be kept, got %v, %v, %v", csr.DNSNames, csr.IPAddresses, csr.EmailAddresses)
+	}
+
+	// Running again must keep the published CSR, it matches the request.
+	requirerStateOut = requirerCtx.Run("update-status", requirerStateOut)
+
+	if requirerCtx.CharmErr != nil {
+		t.Fatalf("requirer charm error: %v", requirerCtx.CharmErr)
+	}
+
+	err = json.Unmarshal([]byte(requirerStateOut.Relations[0].LocalUnitData["certificate_signing_requests"]), &csrData)
+	if err != nil {
+		t.Fatalf("failed to unmarshal relation data: %v", err)
+	}
+
+	if len(csrData) != 1 || csrData[0].CertificateSigningRequest != csrPEM {
+		t.Fatalf("expected the published CSR to be kept")
+	}
+
+	providerCtx := goopstest.NewContext(
+		GetOutstandingOIDSansExampleUse,
+		goopstest.WithUnitID("provider/0"),
+		goopstest.WithAppName("provider"),
+	)
+
+	requestData, err := json.Marshal([]map[string]any{
+		{"certificate_signing_request": csrPEM, "ca": false},
+	})
+	if err != nil {
+		t.Fatalf("failed to marshal request data: %v", err)
+	}
+
+	providerStateOut := providerCtx.Run("start", goopstest.State{
+		Leader: true,
+		Relations: []goopstest.Relation{
+			{
+				Endpoint:      "certificates",
+				RemoteAppName: "requirer",
+				RemoteUnitsData: map[goopstest.UnitID]goopstest.DataBag{
+					"requirer/0": {
+						"certificate_signing_requests": string(requestData),
+					},
+				},
+			},
+		},
+	})
+
+	if providerCtx.CharmErr != nil {
+		t.Fatalf("provider charm error: %v", providerCtx.CharmErr)
+	}
+
+	var certs []certificates.CertificateSigningRequestProviderAppRelationData
+
+	err = json.Unmarshal([]byte(providerStateOut.Relations[0].LocalAppData["certificates"]), &certs)
+	if err != nil {
+		t.Fatalf("failed to unmarshal provider relation data: %v", err)
+	}
+
+	if len(certs) != 1 {
+		t.Fatalf("expected 1 certificate, got %d", len(certs))
+	}
+
+	cert, err := certificates.ParseCertificate(certs[0].Certificate)
+	if err != nil {
+		t.Fatalf("failed to parse certificate: %v", err)
+	}
+
+	if !slices.Equal(cert.SansOID, []string{"1.3.6.1.4.1.28978.1"}) {
+		t.Errorf("expected OID SAN 1.3.6.1.4.1.28978.1 in the certificate, got %v", cert.SansOID)
+	}
+
+	if !slices.Equal(cert.SansDNS, []string{"example.com"}) || !slices.Equal(cert.SansIP, []string{"1.2.3.4"}) {
+		t.Errorf("expected the other SANs in the certificate, got %v, %v", cert.SansDNS, cert.SansIP)
+	}
+
+	roots := x509.NewCertPool()
+	roots.AddCert(parseCertificate(t, certs[0].CA))
+
+	_, err = parseCertificate(t, certs[0].Certificate).Verify(x509.VerifyOptions{DNSName: "example.com", Roots: roots})
+	if err != nil {
+		t.Errorf("failed to verify certificate: %v", err)
+	}
+}
+
+// The signed certificate only carries the names the library understands, an
+// otherName requested next to a registered ID is dropped.
+func TestSignCertificateSigningRequestRebuildsSANs(t *testing.T) {
+	privateKey, _ := generatePrivateKeyPEM(t)
+
+	marshal := func(value any) []byte {
+		der, err := asn1.Marshal(value)
+		if err != nil {
+			t.Fatalf("failed to marshal: %v", err)
+		}
+
+		return der
+	}
+
+	otherNameValue := marshal(asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: marshal("smuggled")})
+	registeredID := marshal(asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 28978, 1})
+
+	sans := marshal([]asn1.RawValue{
+		{Class: asn1.ClassContextSpecific, Tag: 2, Bytes: []byte("example.com")},
+		{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: append(marshal(asn1.ObjectIdentifier{1, 2, 3, 4}), otherNameValue...)},
+		{Class: asn1.ClassContextSpecific, Tag: 8, Bytes: registeredID[2:]},
+	})
+
+	csrDER, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:         pkix.Name{CommonName: "example.com"},
+		ExtraExtensions: []pkix.Extension{{Id: asn1.ObjectIdentifier{2, 5, 29, 17}, Value: sans}},
+	}, privateKey)
+	if err != nil {
+		t.Fatalf("failed to create certificate signing request: %v", err)
+	}
+
+	csrPEM := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: csrDER}))
+
+	caPEM, caKeyPEM, err := certificates.GenerateCA(&certificates.GenerateCAOpts{
+		CommonName:       "Example CA",
+		ValidityDuration: 24 * time.Hour,
+	})
+	if err != nil {
+		t.Fatalf("failed to generate CA: %v", err)
+	}
+
+	certPEM, err := certificates.SignCertificateSigningRequest(csrPEM, caPEM, caKeyPEM, nil)
+	if err != nil {
+		t.Fatalf("failed to sign certificate signing request: %v", err)
+	}
+
+	cert := parseCertificate(t, certPEM)
+
+	for _, extension := range cert.Extensions {
+		if !extension.Id.Equal(asn1.ObjectIdentifier{2, 5, 29, 17}) {
+			continue
+		}
+
+		var names []asn1.RawValue
+
+		_, err = asn1.Unmarshal(extension.Value, &names)
+		if err != nil {
+			t.Fatalf("failed to parse subject alternative name: %v", err)
+		}
+
+		tags := make([]int, 0, len(names))
+		for _, name := range names {
+			tags = append(tags, name.Tag)
+		}
+
+		if !slices.Equal(tags, []int{2, 8}) {
+			t.Fatalf("expected only the DNS name and the registered ID, got tags %v", tags)
+		}
+
+		return
+	}
+
+	t.Fatalf("expected a subject alternative name extension")
+}
+
+func parseCSR(t *testing.T, csrPEM string) *x509.CertificateRequest {
+	t.Helper()
+
+	block, _ := pem.Decode([]byte(csrPEM))
+
+	csr, err := parseCSRBlock(block)
+	if err != nil {
+		t.Fatalf("failed to parse certificate signing request: %v", err)
+	}
+
+	return csr
+}
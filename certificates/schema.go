@@ -0,0 +1,258 @@
+package certificates
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+)
+
+// The data bag models follow version 4 of the tls-certificates charm
+// library, the layout of the published tls-certificates interface. Parsing
+// accepts the legacy encodings older libraries wrote: booleans and integers
+// as strings, and the chain as a JSON encoded list. Output is always
+// canonical.
+
+const (
+	certificateSigningRequestsKey = "certificate_signing_requests"
+	certificatesKey               = "certificates"
+)
+
+// CertificateSigningRequestV4 is an entry of the requirer data bag.
+type CertificateSigningRequestV4 struct {
+	CertificateSigningRequest string `json:"certificate_signing_request"`
+	CA                        bool   `json:"ca"`
+}
+
+func (r *CertificateSigningRequestV4) UnmarshalJSON(data []byte) error {
+	var raw struct {
+		CertificateSigningRequest string          `json:"certificate_signing_request"`
+		CA                        json.RawMessage `json:"ca"`
+	}
+
+	err := json.Unmarshal(data, &raw)
+	if err != nil {
+		return err
+	}
+
+	ca, err := decodeLenientBool(raw.CA)
+	if err != nil {
+		return fmt.Errorf("could not unmarshal ca: %w", err)
+	}
+
+	r.CertificateSigningRequest = raw.CertificateSigningRequest
+	r.CA = ca
+
+	return nil
+}
+
+// CertificateV4 is an entry of the provider app data bag.
+type CertificateV4 struct {
+	CA                        string   `json:"ca"`
+	Chain                     []string `json:"chain"`
+	CertificateSigningRequest string   `json:"certificate_signing_request"`
+	Certificate               string   `json:"certificate"`
+	Revoked                   bool     `json:"revoked,omitempty"`
+	// RecommendedExpiryNotificationTime is in hours before expiry.
+	RecommendedExpiryNotificationTime *int   `json:"recommended_expiry_notification_time,omitempty"`
+	ExpiryTime                        string `json:"expiry_time,omitempty"`
+}
+
+func (c CertificateV4) MarshalJSON() ([]byte, error) {
+	type certificate CertificateV4
+
+	out := certificate(c)
+	if out.Chain == nil {
+		out.Chain = []string{}
+	}
+
+	return json.Marshal(out)
+}
+
+func (c *CertificateV4) UnmarshalJSON(data []byte) error {
+	var raw struct {
+		CA                                string          `json:"ca"`
+		Chain                             json.RawMessage `json:"chain"`
+		CertificateSigningRequest         string          `json:"certificate_signing_request"`
+		Certificate                       string          `json:"certificate"`
+		Revoked                           json.RawMessage `json:"revoked"`
+		RecommendedExpiryNotificationTime json.RawMessage `json:"recommended_expiry_notification_time"`
+		ExpiryTime                        string          `json:"expiry_time"`
+	}
+
+	err := json.Unmarshal(data, &raw)
+	if err != nil {
+		return err
+	}
+
+	chain, err := decodeChain(raw.Chain)
+	if err != nil {
+		return err
+	}
+
+	revoked, err := decodeLenientBool(raw.Revoked)
+	if err != nil {
+		return fmt.Errorf("could not unmarshal revoked: %w", err)
+	}
+
+	notificationTime, err := decodeLenientInt(raw.RecommendedExpiryNotificationTime)
+	if err != nil {
+		return fmt.Errorf("could not unmarshal recommended_expiry_notification_time: %w", err)
+	}
+
+	*c = CertificateV4{
+		CA:                                raw.CA,
+		Chain:                             chain,
+		CertificateSigningRequest:         raw.CertificateSigningRequest,
+		Certificate:                       raw.Certificate,
+		Revoked:                           revoked,
+		RecommendedExpiryNotificationTime: notificationTime,
+		ExpiryTime:                        raw.ExpiryTime,
+	}
+
+	return nil
+}
+
+// RequirerDatabagV4 is the unit or app data bag of a requirer.
+type RequirerDatabagV4 struct {
+	CertificateSigningRequests []CertificateSigningRequestV4
+}
+
+// Load parses the data bag. A data bag without requests is empty.
+func (d *RequirerDatabagV4) Load(relationData map[string]string) error {
+	d.CertificateSigningRequests = []CertificateSigningRequestV4{}
+
+	value := relationData[certificateSigningRequestsKey]
+	if value == "" {
+		return nil
+	}
+
+	err := json.Unmarshal([]byte(value), &d.CertificateSigningRequests)
+	if err != nil {
+		return fmt.Errorf("could not unmarshal certificate signing requests: %w", err)
+	}
+
+	return nil
+}
+
+func (d *RequirerDatabagV4) Dump() (map[string]string, error) {
+	requests := d.CertificateSigningRequests
+	if requests == nil {
+		requests = []CertificateSigningRequestV4{}
+	}
+
+	value, err := json.Marshal(requests)
+	if err != nil {
+		return nil, fmt.Errorf("could not marshal certificate signing requests: %w", err)
+	}
+
+	return map[string]string{certificateSigningRequestsKey: string(value)}, nil
+}
+
+// ProviderDatabagV4 is the app data bag of a provider.
+type ProviderDatabagV4 struct {
+	Certificates []CertificateV4
+}
+
+// Load parses the data bag. A data bag without certificates is empty.
+func (d *ProviderDatabagV4) Load(relationData map[string]string) error {
+	d.Certificates = []CertificateV4{}
+
+	value := relationData[certificatesKey]
+	if value == "" {
+		return nil
+	}
+
+	err := json.Unmarshal([]byte(value), &d.Certificates)
+	if err != nil {
+		return fmt.Errorf("could not unmarshal certificates: %w", err)
+	}
+
+	return nil
+}
+
+func (d *ProviderDatabagV4) Dump() (map[string]string, error) {
+	certificates := d.Certificates
+	if certificates == nil {
+		certificates = []CertificateV4{}
+	}
+
+	value, err := json.Marshal(certificates)
+	if err != nil {
+		return nil, fmt.Errorf("could not marshal certificates: %w", err)
+	}
+
+	return map[string]string{certificatesKey: string(value)}, nil
+}
+
+func decodeChain(rawChain json.RawMessage) ([]string, error) {
+	chain := []string{}
+
+	if len(rawChain) == 0 || string(rawChain) == "null" {
+		return chain, nil
+	}
+
+	if err := json.Unmarshal(rawChain, &chain); err == nil {
+		return chain, nil
+	}
+
+	var chainJSON string
+
+	if err := json.Unmarshal(rawChain, &chainJSON); err != nil {
+		return nil, fmt.Errorf("could not unmarshal chain: %w", err)
+	}
+
+	if err := json.Unmarshal([]byte(chainJSON), &chain); err != nil {
+		return nil, fmt.Errorf("could not unmarshal chain array: %w", err)
+	}
+
+	return chain, nil
+}
+
+// decodeLenientBool accepts a JSON boolean or a string holding one. A
+// missing value is false.
+func decodeLenientBool(raw json.RawMessage) (bool, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return false, nil
+	}
+
+	var value bool
+	if err := json.Unmarshal(raw, &value); err == nil {
+		return value, nil
+	}
+
+	var valueStr string
+	if err := json.Unmarshal(raw, &valueStr); err != nil {
+		return false, fmt.Errorf("%s is not a boolean", raw)
+	}
+
+	if valueStr == "" {
+		return false, nil
+	}
+
+	return strconv.ParseBool(valueStr)
+}
+
+// decodeLenientInt accepts a JSON number or a string holding one. A missing
+// value is nil.
+func decodeLenientInt(raw json.RawMessage) (*int, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil, nil
+	}
+
+	var value int
+	if err := json.Unmarshal(raw, &value); err == nil {
+		return &value, nil
+	}
+
+	var valueStr string
+	if err := json.Unmarshal(raw, &valueStr); err != nil {
+		return nil, fmt.Errorf("%s is not an integer", raw)
+	}
+
+	value, err := strconv.Atoi(valueStr)
+	if err != nil {
+		return nil, err
+	}
+
+	return &value, nil
+}
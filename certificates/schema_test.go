@@ -0,0 +1,120 @@
+package certificates_test
+
+import (
+	"testing"
+
+	"github.com/gruyaume/charm-libraries/certificates"
+)
+
+func TestRequirerDatabagV4Load(t *testing.T) {
+	tests := []struct {
+		name     string
+		value    string
+		expected bool
+	}{
+		{"boolean", `[{"certificate_signing_request":"csr","ca":true}]`, true},
+		{"legacy string", `[{"certificate_signing_request":"csr","ca":"True"}]`, true},
+		{"legacy false string", `[{"certificate_signing_request":"csr","ca":"false"}]`, false},
+		{"missing", `[{"certificate_signing_request":"csr"}]`, false},
+		{"null", `[{"certificate_signing_request":"csr","ca":null}]`, false},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var databag certificates.RequirerDatabagV4
+
+			err := databag.Load(map[string]string{"certificate_signing_requests": tc.value})
+			if err != nil {
+				t.Fatalf("failed to load data bag: %v", err)
+			}
+
+			if len(databag.CertificateSigningRequests) != 1 {
+				t.Fatalf("expected 1 certificate signing request, got %d", len(databag.CertificateSigningRequests))
+			}
+
+			if databag.CertificateSigningRequests[0].CA != tc.expected {
+				t.Fatalf("expected CA to be %v", tc.expected)
+			}
+		})
+	}
+}
+
+func TestRequirerDatabagV4Dump(t *testing.T) {
+	databag := certificates.RequirerDatabagV4{
+		CertificateSigningRequests: []certificates.CertificateSigningRequestV4{
+			{CertificateSigningRequest: "csr"},
+		},
+	}
+
+	relationData, err := databag.Dump()
+	if err != nil {
+		t.Fatalf("failed to dump data bag: %v", err)
+	}
+
+	expected := `[{"certificate_signing_request":"csr","ca":false}]`
+	if relationData["certificate_signing_requests"] != expected {
+		t.Fatalf("expected %s, got %s", expected, relationData["certificate_signing_requests"])
+	}
+}
+
+func TestProviderDatabagV4Load(t *testing.T) {
+	var databag certificates.ProviderDatabagV4
+
+	err := databag.Load(map[string]string{
+		"certificates": `[` +
+			`{"ca":"ca","chain":"[\"cert\", \"ca\"]","certificate_signing_request":"csr-a","certificate":"cert","revoked":"true","recommended_expiry_notification_time":"168"},` +
+			`{"ca":"ca","chain":null,"certificate_signing_request":"csr-b","certificate":"cert","revoked":false,"recommended_expiry_notification_time":24,"expiry_time":"2030-01-01T00:00:00Z"}` +
+			`]`,
+	})
+	if err != nil {
+		t.Fatalf("failed to load data bag: %v", err)
+	}
+
+	if len(databag.Certificates) != 2 {
+		t.Fatalf("expected 2 certificates, got %d", len(databag.Certificates))
+	}
+
+	legacy := databag.Certificates[0]
+	if len(legacy.Chain) != 2 || !legacy.Revoked || legacy.RecommendedExpiryNotificationTime == nil || *legacy.RecommendedExpiryNotificationTime != 168 {
+		t.Fatalf("unexpected legacy entry: %+v", legacy)
+	}
+
+	current := databag.Certificates[1]
+	if current.Chain == nil || current.Revoked || *current.RecommendedExpiryNotificationTime != 24 || current.ExpiryTime != "2030-01-01T00:00:00Z" {
+		t.Fatalf("unexpected entry: %+v", current)
+	}
+}
+
+func TestProviderDatabagV4Dump(t *testing.T) {
+	databag := certificates.ProviderDatabagV4{
+		Certificates: []certificates.CertificateV4{
+			{CA: "ca", CertificateSigningRequest: "csr", Certificate: "cert"},
+		},
+	}
+
+	relationData, err := databag.Dump()
+	if err != nil {
+		t.Fatalf("failed to dump data bag: %v", err)
+	}
+
+	expected := `[{"ca":"ca","chain":[],"certificate_signing_request":"csr","certificate":"cert"}]`
+	if relationData["certificates"] != expected {
+		t.Fatalf("expected %s, got %s", expected, relationData["certificates"])
+	}
+}
+
+func TestDatabagV4LoadEmpty(t *testing.T) {
+	var providerDatabag certificates.ProviderDatabagV4
+
+	err := providerDatabag.Load(map[string]string{})
+	if err != nil || providerDatabag.Certificates == nil || len(providerDatabag.Certificates) != 0 {
+		t.Fatalf("expected an empty provider data bag, got %v, %v", providerDatabag.Certificates, err)
+	}
+
+	var requirerDatabag certificates.RequirerDatabagV4
+
+	err = requirerDatabag.Load(nil)
+	if err != nil || requirerDatabag.CertificateSigningRequests == nil || len(requirerDatabag.CertificateSigningRequests) != 0 {
+		t.Fatalf("expected an empty requirer data bag, got %v, %v", requirerDatabag.CertificateSigningRequests, err)
+	}
+}
@@ -0,0 +1,154 @@
+package certificates
+
+import (
+	"crypto"
+	"crypto/x509"
+	"fmt"
+	"time"
+)
+
+// Signer turns an approved certificate request into a certificate and its
+// chain. The provider issuance flow only depends on this interface, so the CA
+// key can live in a secret, in an HSM or behind a signing service.
+// CertificateAuthority, KeySigner and PKCS11Signer implement it.
+type Signer interface {
+	Sign(request RequirerCertificateRequest) (*SetRelationCertificateOptions, error)
+}
+
+// IssueCertificates signs the requests with the signer and publishes the
+// certificates in one batch. Nothing is published if one request fails.
+func (p *IntegrationProvider) IssueCertificates(signer Signer, requests []RequirerCertificateRequest) error {
+	opts := make([]*SetRelationCertificateOptions, 0, len(requests))
+
+	for _, request := range requests {
+		opt, err := signer.Sign(request)
+		if err != nil {
+			return fmt.Errorf("could not sign certificate for %s: %w", request.CertificateSigningRequest.CommonName, err)
+		}
+
+		opts = append(opts, opt)
+	}
+
+	if len(opts) == 0 {
+		return nil
+	}
+
+	return p.SetRelationCertificates(opts)
+}
+
+// SignApprovedCertificateRequests evaluates the outstanding certificate
+// requests with the policy, issues certificates for the approved ones and
+// returns every result, so the charm can report the denied and pending ones.
+func (p *IntegrationProvider) SignApprovedCertificateRequests(signer Signer, policy *Policy) ([]PolicyResult, error) {
+	results, err := p.EvaluateOutstandingCertificateRequests(policy)
+	if err != nil {
+		return nil, err
+	}
+
+	approved := make([]RequirerCertificateRequest, 0, len(results))
+
+	for _, result := range results {
+		if result.Decision == DecisionApproved {
+			approved = append(approved, result.Request)
+		}
+	}
+
+	err = p.IssueCertificates(signer, approved)
+	if err != nil {
+		return nil, err
+	}
+
+	return results, nil
+}
+
+// KeySigner signs with a CA key available as a crypto.Signer.
+type KeySigner struct {
+	// Chain holds the issuing CA certificate first, then its issuers up to
+	// the root, which is published as the CA.
+	Chain []string
+	Key   crypto.Signer
+	// CertificateValidity defaults to DefaultCertificateValidity. Issued
+	// certificates never outlive the issuing CA.
+	CertificateValidity time.Duration
+	// KeyUsage and ExtKeyUsage apply to leaf certificates, as in
+	// CertificateAuthority.
+	KeyUsage    x509.KeyUsage
+	ExtKeyUsage []x509.ExtKeyUsage
+}
+
+// NewLocalKeySigner returns a KeySigner for a CA key held in memory.
+func NewLocalKeySigner(chain []string, keyPEM string) (*KeySigner, error) {
+	key, err := parsePrivateKeyPEM(keyPEM)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse CA private key: %w", err)
+	}
+
+	signer := &KeySigner{Chain: chain, Key: key}
+
+	_, err = signer.issuer()
+	if err != nil {
+		return nil, err
+	}
+
+	return signer, nil
+}
+
+// Sign issues a certificate for the request. Requests for a CA certificate
+// get an intermediate CA that can only sign leaf certificates.
+func (s *KeySigner) Sign(request RequirerCertificateRequest) (*SetRelationCertificateOptions, error) {
+	issuer, err := s.issuer()
+	if err != nil {
+		return nil, err
+	}
+
+	csr, err := parseCertificateSigningRequestPEM(request.CertificateSigningRequest.Raw)
+	if err != nil {
+		return nil, err
+	}
+
+	validity := s.CertificateValidity
+	if validity == 0 {
+		validity = DefaultCertificateValidity
+	}
+
+	certPEM, err := signCertificateSigningRequest(csr, issuer, s.Key, &SignCertificateSigningRequestOpts{
+		ValidityDuration: validity,
+		IsCA:             request.IsCA,
+		KeyUsage:         s.KeyUsage,
+		ExtKeyUsage:      s.ExtKeyUsage,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &SetRelationCertificateOptions{
+		RelationID:                request.RelationID,
+		CA:                        s.Chain[len(s.Chain)-1],
+		Chain:                     append([]string{certPEM}, s.Chain...),
+		CertificateSigningRequest: request.CertificateSigningRequest.Raw,
+		Certificate:               certPEM,
+	}, nil
+}
+
+// issuer returns the issuing CA certificate, after checking that it matches
+// the key.
+func (s *KeySigner) issuer() (*x509.Certificate, error) {
+	if len(s.Chain) == 0 {
+		return nil, fmt.Errorf("CA chain is empty")
+	}
+
+	if s.Key == nil {
+		return nil, fmt.Errorf("CA key is missing")
+	}
+
+	issuer, err := parseCertificatePEM(s.Chain[0])
+	if err != nil {
+		return nil, fmt.Errorf("could not parse CA certificate: %w", err)
+	}
+
+	if !publicKeysEqual(issuer.PublicKey, s.Key.Public()) {
+		return nil, fmt.Errorf("CA certificate does not match the CA key")
+	}
+
+	return issuer, nil
+}
@@ -0,0 +1,159 @@
+package certificates_test
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/gruyaume/charm-libraries/certificates"
+	"github.com/gruyaume/goops/goopstest"
+)
+
+// generateTestChain returns an intermediate CA signed by a root CA, with the
+// intermediate private key.
+func generateTestChain(t *testing.T) ([]string, string) {
+	t.Helper()
+
+	rootPEM, rootKeyPEM, err := certificates.GenerateCA(&certificates.GenerateCAOpts{
+		CommonName:       "Root CA",
+		ValidityDuration: 24 * time.Hour,
+		KeyAlgorithm:     certificates.KeyAlgorithmECDSAP256,
+	})
+	if err != nil {
+		t.Fatalf("failed to generate root CA: %v", err)
+	}
+
+	intermediatePEM, intermediateKeyPEM, err := certificates.GenerateCA(&certificates.GenerateCAOpts{
+		CommonName:        "Intermediate CA",
+		ValidityDuration:  12 * time.Hour,
+		KeyAlgorithm:      certificates.KeyAlgorithmECDSAP256,
+		IssuerCertificate: rootPEM,
+		IssuerPrivateKey:  rootKeyPEM,
+	})
+	if err != nil {
+		t.Fatalf("failed to generate intermediate CA: %v", err)
+	}
+
+	return []string{intermediatePEM, rootPEM}, intermediateKeyPEM
+}
+
+func SignApprovedCertificateRequestsExampleUse(chain []string, keyPEM string) func() error {
+	return func() error {
+		signer, err := certificates.NewLocalKeySigner(chain, keyPEM)
+		if err != nil {
+			return fmt.Errorf("failed to create signer: %w", err)
+		}
+
+		ip := &certificates.IntegrationProvider{
+			RelationName: "certificates",
+		}
+
+		results, err := ip.SignApprovedCertificateRequests(signer, &certificates.Policy{
+			Rules: []certificates.PolicyRule{
+				certificates.AllowedDomainsRule{Suffixes: []string{"example.com"}},
+			},
+		})
+		if err != nil {
+			return fmt.Errorf("failed to sign approved certificate requests: %w", err)
+		}
+
+		if len(results) != 2 {
+			return fmt.Errorf("expected 2 policy results, got %d", len(results))
+		}
+
+		return nil
+	}
+}
+
+func TestSignApprovedCertificateRequestsWithLocalKeySigner(t *testing.T) {
+	chain, keyPEM := generateTestChain(t)
+
+	ctx := goopstest.NewContext(
+		SignApprovedCertificateRequestsExampleUse(chain, keyPEM),
+		goopstest.WithUnitID("provider/0"),
+		goopstest.WithAppName("provider"),
+	)
+
+	privateKey, _ := generatePrivateKeyPEM(t)
+	approvedCSR := generateCSRForKey(t, privateKey, "server.example.com")
+	deniedCSR := generateCSRForKey(t, privateKey, "server.example.org")
+
+	requestData, err := json.Marshal([]map[string]any{
+		{"certificate_signing_request": approvedCSR, "ca": false},
+		{"certificate_signing_request": deniedCSR, "ca": false},
+	})
+	if err != nil {
+		t.Fatalf("failed to marshal request data: %v", err)
+	}
+
+	stateIn := goopstest.State{
+		Leader: true,
+		Relations: []goopstest.Relation{
+			{
+				Endpoint:      "certificates",
+				RemoteAppName: "requirer",
+				RemoteUnitsData: map[goopstest.UnitID]goopstest.DataBag{
+					"requirer/0": {
+						"certificate_signing_requests": string(requestData),
+					},
+				},
+			},
+		},
+	}
+
+	stateOut := ctx.Run("start", stateIn)
+
+	if ctx.CharmErr != nil {
+		t.Fatalf("charm error: %v", ctx.CharmErr)
+	}
+
+	var certs []certificates.CertificateV4
+
+	err = json.Unmarshal([]byte(stateOut.Relations[0].LocalAppData["certificates"]), &certs)
+	if err != nil {
+		t.Fatalf("failed to unmarshal relation data: %v", err)
+	}
+
+	if len(certs) != 1 || certs[0].CertificateSigningRequest != approvedCSR {
+		t.Fatalf("expected only the approved request to be signed, got %d certificates", len(certs))
+	}
+
+	if certs[0].CA != chain[1] {
+		t.Errorf("expected the root CA to be published as the CA")
+	}
+
+	if len(certs[0].Chain) != 3 || certs[0].Chain[0] != certs[0].Certificate || certs[0].Chain[1] != chain[0] {
+		t.Fatalf("expected chain certificate, intermediate, root; got %d entries", len(certs[0].Chain))
+	}
+
+	roots := x509.NewCertPool()
+	roots.AddCert(parseCertificate(t, chain[1]))
+
+	intermediates := x509.NewCertPool()
+	intermediates.AddCert(parseCertificate(t, chain[0]))
+
+	_, err = parseCertificate(t, certs[0].Certificate).Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+	})
+	if err != nil {
+		t.Fatalf("failed to verify issued certificate: %v", err)
+	}
+}
+
+func TestNewLocalKeySignerRejectsMismatchedKey(t *testing.T) {
+	chain, _ := generateTestChain(t)
+	_, otherKeyPEM := generateTestChain(t)
+
+	_, err := certificates.NewLocalKeySigner(chain, otherKeyPEM)
+	if err == nil {
+		t.Fatalf("expected an error for a key that does not match the CA")
+	}
+
+	_, err = certificates.NewLocalKeySigner(nil, otherKeyPEM)
+	if err == nil {
+		t.Fatalf("expected an error for an empty chain")
+	}
+}
@@ -0,0 +1,242 @@
+package certificates
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"strings"
+
+	"github.com/gruyaume/goops"
+)
+
+// The certificate_transfer interface distributes trusted CA certificates.
+// Version 1 publishes them in the provider app data bag as a JSON list of PEM
+// certificates. Version 0 (send-ca-cert) used the unit data bags, with the
+// ca, certificate and chain keys; the requirer still reads ca and chain. The
+// certificate is the sender's own leaf and is never trusted.
+
+// CertificateTransferProvider publishes CA certificates to the related apps.
+type CertificateTransferProvider struct {
+	RelationName string
+}
+
+// CertificateTransferRequirer collects the CA certificates of the related
+// apps.
+type CertificateTransferRequirer struct {
+	RelationName string
+}
+
+// TrustBundle holds the CA certificates received over one relation.
+type TrustBundle struct {
+	RelationID   string
+	RemoteApp    string
+	Certificates []string
+}
+
+// PublishCertificates publishes the CA certificates in the relation,
+// replacing the ones published before. Each string may hold a single
+// certificate or a whole chain; they are split, validated and deduplicated.
+func (p *CertificateTransferProvider) PublishCertificates(relationID string, certificates []string) error {
+	isLeader, err := goops.IsLeader()
+	if err != nil {
+		return fmt.Errorf("could not determine if unit is leader: %w", err)
+	}
+
+	if !isLeader {
+		return fmt.Errorf("unit is not the leader and cannot set app relation data")
+	}
+
+	bundle, errs := splitCertificates(certificates)
+	if len(errs) > 0 {
+		return fmt.Errorf("%w: %v", ErrInvalidCertificate, errs[0])
+	}
+
+	certificatesJSON, err := json.Marshal(bundle)
+	if err != nil {
+		return fmt.Errorf("could not marshal certificates: %w", err)
+	}
+
+	err = goops.SetAppRelationData(relationID, map[string]string{
+		"certificates": string(certificatesJSON),
+		"version":      "1",
+	})
+	if err != nil {
+		return fmt.Errorf("could not set relation data: %w", err)
+	}
+
+	return nil
+}
+
+// PublishCertificatesToAllRelations publishes the same CA certificates in
+// every relation.
+func (p *CertificateTransferProvider) PublishCertificatesToAllRelations(certificates []string) error {
+	if p.RelationName == "" {
+		return fmt.Errorf("relation name is empty")
+	}
+
+	relationIDs, err := goops.GetRelationIDs(p.RelationName)
+	if err != nil {
+		return fmt.Errorf("could not get relation IDs: %w", err)
+	}
+
+	for _, relationID := range relationIDs {
+		err = p.PublishCertificates(relationID, certificates)
+		if err != nil {
+			return fmt.Errorf("could not publish certificates in relation %s: %w", relationID, err)
+		}
+	}
+
+	return nil
+}
+
+// GetTrustBundles returns the CA certificates of every related app, one
+// bundle per relation. Certificates that cannot be parsed are skipped.
+func (r *CertificateTransferRequirer) GetTrustBundles() ([]TrustBundle, error) {
+	if r.RelationName == "" {
+		return nil, fmt.Errorf("relation name is empty")
+	}
+
+	relationIDs, err := goops.GetRelationIDs(r.RelationName)
+	if err != nil {
+		return nil, fmt.Errorf("could not get relation IDs: %w", err)
+	}
+
+	bundles := make([]TrustBundle, 0, len(relationIDs))
+
+	for _, relationID := range relationIDs {
+		relationUnits, err := goops.ListRelationUnits(relationID)
+		if err != nil {
+			return nil, fmt.Errorf("could not list relation units: %w", err)
+		}
+
+		if len(relationUnits) == 0 {
+			continue
+		}
+
+		bundle := TrustBundle{
+			RelationID: relationID,
+			RemoteApp:  strings.Split(relationUnits[0], "/")[0],
+		}
+
+		appRelationData, err := goops.GetAppRelationData(relationID, relationUnits[0])
+		if err != nil {
+			return nil, fmt.Errorf("could not get app relation data: %w", err)
+		}
+
+		received := readTransferredCertificates(appRelationData["certificates"])
+
+		for _, unitID := range relationUnits {
+			unitRelationData, err := goops.GetUnitRelationData(relationID, unitID)
+			if err != nil {
+				return nil, fmt.Errorf("could not get relation data: %w", err)
+			}
+
+			received = append(received, unitRelationData["ca"])
+			received = append(received, readTransferredCertificates(unitRelationData["chain"])...)
+		}
+
+		bundle.Certificates = filterCertificates(received)
+
+		bundles = append(bundles, bundle)
+	}
+
+	return bundles, nil
+}
+
+// GetCertificates returns the CA certificates of every related app,
+// deduplicated.
+func (r *CertificateTransferRequirer) GetCertificates() ([]string, error) {
+	bundles, err := r.GetTrustBundles()
+	if err != nil {
+		return nil, err
+	}
+
+	var certificates []string
+
+	for _, bundle := range bundles {
+		certificates = append(certificates, bundle.Certificates...)
+	}
+
+	return filterCertificates(certificates), nil
+}
+
+// filterCertificates is splitCertificates for received certificates: the
+// invalid ones are logged and skipped.
+func filterCertificates(values []string) []string {
+	certificates, errs := splitCertificates(values)
+
+	for _, err := range errs {
+		goops.LogWarningf("Skipping invalid transferred certificate: %v", err)
+	}
+
+	return certificates
+}
+
+// readTransferredCertificates parses a JSON list of certificates. Anything
+// else is taken as PEM.
+func readTransferredCertificates(value string) []string {
+	if value == "" {
+		return nil
+	}
+
+	var certificates []string
+
+	err := json.Unmarshal([]byte(value), &certificates)
+	if err != nil {
+		return []string{value}
+	}
+
+	return certificates
+}
+
+// splitCertificates splits PEM bundles into single certificates and keeps
+// the first occurrence of each. The values that hold something else than
+// certificates are reported as errors.
+func splitCertificates(values []string) ([]string, []error) {
+	certificates := make([]string, 0)
+	seen := make(map[[sha256.Size]byte]bool)
+
+	var errs []error
+
+	for _, value := range values {
+		if strings.TrimSpace(value) == "" {
+			continue
+		}
+
+		rest := []byte(value)
+		found := false
+
+		for {
+			var block *pem.Block
+
+			block, rest = pem.Decode(rest)
+			if block == nil {
+				break
+			}
+
+			found = true
+			certificatePEM := string(pem.EncodeToMemory(block))
+
+			if _, err := parseCertificatePEM(certificatePEM); err != nil {
+				errs = append(errs, err)
+				continue
+			}
+
+			fingerprint := sha256.Sum256(block.Bytes)
+			if seen[fingerprint] {
+				continue
+			}
+
+			seen[fingerprint] = true
+
+			certificates = append(certificates, certificatePEM)
+		}
+
+		if !found {
+			errs = append(errs, fmt.Errorf("no PEM certificate found"))
+		}
+	}
+
+	return certificates, errs
+}
@@ -0,0 +1,172 @@
+package certificates_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"testing"
+
+	"github.com/gruyaume/charm-libraries/certificates"
+	"github.com/gruyaume/goops/goopstest"
+)
+
+func PublishCertificatesExampleUse(certs []string) func() error {
+	return func() error {
+		provider := &certificates.CertificateTransferProvider{
+			RelationName: "send-ca-cert",
+		}
+
+		err := provider.PublishCertificatesToAllRelations(certs)
+		if err != nil {
+			return fmt.Errorf("failed to publish certificates: %w", err)
+		}
+
+		return nil
+	}
+}
+
+func TestPublishCertificates(t *testing.T) {
+	rootCA, _ := generateTestCA(t)
+	intermediateCA, _ := generateTestCA(t)
+
+	ctx := goopstest.NewContext(
+		PublishCertificatesExampleUse([]string{intermediateCA + rootCA, rootCA}),
+	)
+
+	stateIn := goopstest.State{
+		Leader: true,
+		Relations: []goopstest.Relation{
+			{
+				Endpoint:      "send-ca-cert",
+				RemoteAppName: "requirer",
+			},
+		},
+	}
+
+	stateOut := ctx.Run("start", stateIn)
+
+	if ctx.CharmErr != nil {
+		t.Fatalf("charm error: %v", ctx.CharmErr)
+	}
+
+	var published []string
+
+	err := json.Unmarshal([]byte(stateOut.Relations[0].LocalAppData["certificates"]), &published)
+	if err != nil {
+		t.Fatalf("failed to unmarshal relation data: %v", err)
+	}
+
+	if !slices.Equal(published, []string{intermediateCA, rootCA}) {
+		t.Fatalf("expected the chain to be split and deduplicated, got %d certificates", len(published))
+	}
+
+	if stateOut.Relations[0].LocalAppData["version"] != "1" {
+		t.Fatalf("expected version 1, got %q", stateOut.Relations[0].LocalAppData["version"])
+	}
+}
+
+func TestPublishCertificatesRejectsInvalid(t *testing.T) {
+	ctx := goopstest.NewContext(
+		PublishCertificatesExampleUse([]string{"not a certificate"}),
+	)
+
+	stateIn := goopstest.State{
+		Leader: true,
+		Relations: []goopstest.Relation{
+			{
+				Endpoint: "send-ca-cert",
+			},
+		},
+	}
+
+	_ = ctx.Run("start", stateIn)
+
+	if ctx.CharmErr == nil {
+		t.Fatal("expected an error for an invalid certificate")
+	}
+}
+
+func GetTrustBundlesExampleUse(expected [][]string, expectedAll []string) func() error {
+	return func() error {
+		requirer := &certificates.CertificateTransferRequirer{
+			RelationName: "receive-ca-cert",
+		}
+
+		bundles, err := requirer.GetTrustBundles()
+		if err != nil {
+			return fmt.Errorf("failed to get trust bundles: %w", err)
+		}
+
+		if len(bundles) != len(expected) {
+			return fmt.Errorf("expected %d bundles, got %d", len(expected), len(bundles))
+		}
+
+		for i, bundle := range bundles {
+			if !slices.Equal(bundle.Certificates, expected[i]) {
+				return fmt.Errorf("unexpected certificates from %s (%s)", bundle.RemoteApp, bundle.RelationID)
+			}
+		}
+
+		all, err := requirer.GetCertificates()
+		if err != nil {
+			return fmt.Errorf("failed to get certificates: %w", err)
+		}
+
+		if !slices.Equal(all, expectedAll) {
+			return fmt.Errorf("expected %d deduplicated certificates, got %d", len(expectedAll), len(all))
+		}
+
+		return nil
+	}
+}
+
+func TestGetTrustBundles(t *testing.T) {
+	ca1, _ := generateTestCA(t)
+	ca2, _ := generateTestCA(t)
+	ca3, ca3KeyPEM := generateTestCA(t)
+
+	privateKey, _ := generatePrivateKeyPEM(t)
+	leaf := signTestCSR(t, generateCSRForKey(t, privateKey, "provider.example.com"), ca3, ca3KeyPEM)
+
+	v1Certificates, err := json.Marshal([]string{ca1, ca2})
+	if err != nil {
+		t.Fatalf("failed to marshal certificates: %v", err)
+	}
+
+	v0Chain, err := json.Marshal([]string{ca1})
+	if err != nil {
+		t.Fatalf("failed to marshal chain: %v", err)
+	}
+
+	ctx := goopstest.NewContext(
+		GetTrustBundlesExampleUse([][]string{{ca1, ca2, ca3}}, []string{ca1, ca2, ca3}),
+	)
+
+	stateIn := goopstest.State{
+		Relations: []goopstest.Relation{
+			{
+				Endpoint:      "receive-ca-cert",
+				RemoteAppName: "provider",
+				RemoteAppData: goopstest.DataBag{
+					"certificates": string(v1Certificates),
+					"version":      "1",
+				},
+				RemoteUnitsData: map[goopstest.UnitID]goopstest.DataBag{
+					// A unit still publishing with version 0 of the interface,
+					// its own certificate must not be trusted.
+					"provider/0": {
+						"ca":          ca3,
+						"certificate": leaf,
+						"chain":       string(v0Chain),
+					},
+				},
+			},
+		},
+	}
+
+	_ = ctx.Run("update-status", stateIn)
+
+	if ctx.CharmErr != nil {
+		t.Fatalf("charm error: %v", ctx.CharmErr)
+	}
+}
@@ -0,0 +1,249 @@
+package certificates
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"path"
+	"slices"
+	"time"
+
+	"github.com/canonical/pebble/client"
+	"github.com/gruyaume/goops"
+)
+
+// trustStoreStateKey prefixes the unit state key tracking the files a trust
+// store installed. The container name and the trust store name are appended.
+const trustStoreStateKey = "certificates-truststore-"
+
+const (
+	defaultTrustStoreName = "charm"
+	trustStoreExecTimeout = time.Minute
+)
+
+// TrustStoreLayout describes where a distribution keeps the CA certificates
+// trusted by the system and how it rebuilds its trust bundle.
+type TrustStoreLayout struct {
+	Directory     string
+	Extension     string
+	UpdateCommand []string
+}
+
+var (
+	// TrustStoreLayoutDebian is the layout of Debian and Ubuntu images.
+	TrustStoreLayoutDebian = TrustStoreLayout{
+		Directory:     "/usr/local/share/ca-certificates",
+		Extension:     ".crt",
+		UpdateCommand: []string{"update-ca-certificates"},
+	}
+	// TrustStoreLayoutRHEL is the layout of RHEL, CentOS and Fedora images.
+	TrustStoreLayoutRHEL = TrustStoreLayout{
+		Directory:     "/etc/pki/ca-trust/source/anchors",
+		Extension:     ".pem",
+		UpdateCommand: []string{"update-ca-trust", "extract"},
+	}
+)
+
+// TrustStore installs CA certificates in the system trust store of a workload
+// container. Layout defaults to TrustStoreLayoutDebian. Name prefixes the
+// installed files and defaults to "charm"; charms installing several bundles
+// in the same container use one name per bundle.
+type TrustStore struct {
+	ContainerName string
+	Layout        TrustStoreLayout
+	Name          string
+}
+
+// trustStoreState is what the unit remembers about a trust store between
+// hooks. PendingUpdate is set when the files changed but the update command
+// did not succeed yet.
+type trustStoreState struct {
+	Files         []string `json:"files"`
+	PendingUpdate bool     `json:"pending_update,omitempty"`
+}
+
+// Install makes the given CA certificates, and only those, the ones this
+// trust store added to the container. Each value may hold a PEM bundle.
+// Files it installed earlier that are no longer wanted are removed; files it
+// did not install are never touched. The update command runs whenever the
+// files changed. The returned flag tells whether the trust store changed.
+func (s *TrustStore) Install(certificates []string) (bool, error) {
+	if s.ContainerName == "" {
+		return false, fmt.Errorf("container name is required")
+	}
+
+	certificatePEMs, errs := splitCertificates(certificates)
+	if len(errs) > 0 {
+		return false, fmt.Errorf("invalid CA certificate: %w", errors.Join(errs...))
+	}
+
+	layout := s.layout()
+
+	files := make([]containerFile, 0, len(certificatePEMs))
+	for _, certificatePEM := range certificatePEMs {
+		files = append(files, containerFile{
+			Path:        s.filePath(layout, certificatePEM),
+			Content:     certificatePEM,
+			Permissions: defaultCertificatePermissions,
+		})
+	}
+
+	return s.apply(layout, files)
+}
+
+// Remove deletes every CA certificate this trust store installed, for example
+// when the relation providing them goes away, and updates the trust store.
+func (s *TrustStore) Remove() (bool, error) {
+	if s.ContainerName == "" {
+		return false, fmt.Errorf("container name is required")
+	}
+
+	return s.apply(s.layout(), nil)
+}
+
+func (s *TrustStore) apply(layout TrustStoreLayout, files []containerFile) (bool, error) {
+	state := s.loadState()
+	pebble := goops.Pebble(s.ContainerName)
+
+	wanted := make([]string, 0, len(files))
+	changed := false
+
+	for _, file := range files {
+		fileChanged, err := pushFileIfChanged(pebble, file)
+		if err != nil {
+			return false, err
+		}
+
+		wanted = append(wanted, file.Path)
+		changed = changed || fileChanged
+	}
+
+	stale := make([]string, 0)
+
+	for _, file := range state.Files {
+		if !slices.Contains(wanted, file) {
+			stale = append(stale, file)
+		}
+	}
+
+	if len(stale) > 0 {
+		err := execInContainer(pebble, append([]string{"rm", "-f", "--"}, stale...))
+		if err != nil {
+			return false, fmt.Errorf("could not remove CA certificates: %w", err)
+		}
+
+		changed = true
+	}
+
+	slices.Sort(wanted)
+
+	state = trustStoreState{
+		Files:         wanted,
+		PendingUpdate: changed || state.PendingUpdate,
+	}
+
+	err := s.storeState(state)
+	if err != nil {
+		return false, err
+	}
+
+	if !state.PendingUpdate {
+		return false, nil
+	}
+
+	err = execInContainer(pebble, layout.UpdateCommand)
+	if err != nil {
+		return changed, fmt.Errorf("could not update trust store: %w", err)
+	}
+
+	state.PendingUpdate = false
+
+	err = s.storeState(state)
+	if err != nil {
+		return changed, err
+	}
+
+	goops.LogInfof("Updated trust store in container %s", s.ContainerName)
+
+	return true, nil
+}
+
+func (s *TrustStore) layout() TrustStoreLayout {
+	if s.Layout.Directory == "" {
+		return TrustStoreLayoutDebian
+	}
+
+	return s.Layout
+}
+
+func (s *TrustStore) name() string {
+	if s.Name == "" {
+		return defaultTrustStoreName
+	}
+
+	return s.Name
+}
+
+// filePath names the file after the certificate fingerprint, so a certificate
+// keeps its file across calls and distinct certificates never collide.
+func (s *TrustStore) filePath(layout TrustStoreLayout, certificatePEM string) string {
+	block, _ := pem.Decode([]byte(certificatePEM))
+	fingerprint := sha256.Sum256(block.Bytes)
+
+	return path.Join(layout.Directory, s.name()+"-"+hex.EncodeToString(fingerprint[:8])+layout.Extension)
+}
+
+func (s *TrustStore) stateKey() string {
+	return trustStoreStateKey + s.ContainerName + "-" + s.name()
+}
+
+func (s *TrustStore) loadState() trustStoreState {
+	state := trustStoreState{}
+
+	value, err := goops.GetState(s.stateKey())
+	if err != nil || value == "" {
+		return state
+	}
+
+	err = json.Unmarshal([]byte(value), &state)
+	if err != nil {
+		goops.LogWarningf("Discarding unreadable trust store state: %v", err)
+		return trustStoreState{}
+	}
+
+	return state
+}
+
+func (s *TrustStore) storeState(state trustStoreState) error {
+	value, err := json.Marshal(state)
+	if err != nil {
+		return fmt.Errorf("could not marshal trust store state: %w", err)
+	}
+
+	err = goops.SetState(s.stateKey(), string(value))
+	if err != nil {
+		return fmt.Errorf("could not store trust store state: %w", err)
+	}
+
+	return nil
+}
+
+func execInContainer(pebble goops.PebbleClient, command []string) error {
+	process, err := pebble.Exec(&client.ExecOptions{
+		Command: command,
+		Timeout: trustStoreExecTimeout,
+	})
+	if err != nil {
+		return fmt.Errorf("could not run %s: %w", command[0], err)
+	}
+
+	err = process.Wait()
+	if err != nil {
+		return fmt.Errorf("%s failed: %w", command[0], err)
+	}
+
+	return nil
+}
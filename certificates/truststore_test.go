@@ -0,0 +1,282 @@
+package certificates_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/canonical/pebble/client"
+	"github.com/gruyaume/charm-libraries/certificates"
+	"github.com/gruyaume/goops"
+	"github.com/gruyaume/goops/goopstest"
+)
+
+const trustStoreStateKey = "certificates-truststore-workload-provider-ca"
+
+func InstallTrustStoreExampleUse(layout certificates.TrustStoreLayout, cas []string) func() error {
+	return func() error {
+		trustStore := &certificates.TrustStore{
+			ContainerName: "workload",
+			Layout:        layout,
+			Name:          "provider-ca",
+		}
+
+		changed, err := trustStore.Install(cas)
+		if err != nil {
+			return fmt.Errorf("failed to install CA certificates: %w", err)
+		}
+
+		if !changed {
+			return fmt.Errorf("expected trust store to change")
+		}
+
+		return nil
+	}
+}
+
+func RemoveTrustStoreExampleUse() error {
+	trustStore := &certificates.TrustStore{
+		ContainerName: "workload",
+		Name:          "provider-ca",
+	}
+
+	changed, err := trustStore.Remove()
+	if err != nil {
+		return fmt.Errorf("failed to remove CA certificates: %w", err)
+	}
+
+	if !changed {
+		return fmt.Errorf("expected trust store to change")
+	}
+
+	return nil
+}
+
+// execRecorder serves the containers with the goopstest fake pebble client
+// and records the commands executed in them.
+type execRecorder struct {
+	containers []goopstest.Container
+	commands   [][]string
+}
+
+func (r *execRecorder) Pebble(name string) goops.PebbleClient {
+	return &recordingPebbleClient{
+		FakePebbleClient: &goopstest.FakePebbleClient{Containers: r.containers, ContainerName: name},
+		recorder:         r,
+	}
+}
+
+// run installs the recorder as the pebble getter before calling the charm
+// function, since the test context replaces it on every run.
+func (r *execRecorder) run(charmFunc func() error) func() error {
+	return func() error {
+		goops.SetPebbleGetter(r)
+		return charmFunc()
+	}
+}
+
+type recordingPebbleClient struct {
+	*goopstest.FakePebbleClient
+	recorder *execRecorder
+}
+
+func (c *recordingPebbleClient) Exec(opts *client.ExecOptions) (goops.PebbleExecProcess, error) {
+	c.recorder.commands = append(c.recorder.commands, opts.Command)
+	return exitedProcess{}, nil
+}
+
+type exitedProcess struct{}
+
+func (exitedProcess) Wait() error                   { return nil }
+func (exitedProcess) SendResize(_ int, _ int) error { return nil }
+func (exitedProcess) SendSignal(_ string) error     { return nil }
+
+func assertCommands(t *testing.T, recorder *execRecorder, expected ...[]string) {
+	t.Helper()
+
+	if !slices.EqualFunc(recorder.commands, expected, slices.Equal) {
+		t.Fatalf("expected commands %v, got %v", expected, recorder.commands)
+	}
+}
+
+func trustStoreState(layout certificates.TrustStoreLayout, source string, storedState goopstest.StoredState) goopstest.State {
+	return goopstest.State{
+		Containers: []goopstest.Container{
+			{
+				Name:       "workload",
+				CanConnect: true,
+				Mounts: map[string]goopstest.Mount{
+					"ca-certificates": {Location: layout.Directory, Source: source},
+				},
+			},
+		},
+		StoredState: storedState,
+	}
+}
+
+func trackedTrustStoreFiles(t *testing.T, state goopstest.State) []string {
+	t.Helper()
+
+	var tracked struct {
+		Files []string `json:"files"`
+	}
+
+	err := json.Unmarshal([]byte(state.StoredState[trustStoreStateKey]), &tracked)
+	if err != nil {
+		t.Fatalf("failed to unmarshal trust store state: %v", err)
+	}
+
+	return tracked.Files
+}
+
+func TestInstallTrustStore(t *testing.T) {
+	layouts := map[string]certificates.TrustStoreLayout{
+		"debian": certificates.TrustStoreLayoutDebian,
+		"rhel":   certificates.TrustStoreLayoutRHEL,
+	}
+
+	for name, layout := range layouts {
+		t.Run(name, func(t *testing.T) {
+			rootCA, _ := generateTestCA(t)
+			intermediateCA, _ := generateTestCA(t)
+			source := t.TempDir()
+			stateIn := trustStoreState(layout, source, nil)
+			recorder := &execRecorder{containers: stateIn.Containers}
+
+			ctx := goopstest.NewContext(
+				recorder.run(InstallTrustStoreExampleUse(layout, []string{intermediateCA + rootCA, rootCA})),
+			)
+
+			stateOut := ctx.Run("start", stateIn)
+
+			if ctx.CharmErr != nil {
+				t.Fatalf("charm error: %v", ctx.CharmErr)
+			}
+
+			assertCommands(t, recorder, layout.UpdateCommand)
+
+			files := trackedTrustStoreFiles(t, stateOut)
+			if len(files) != 2 {
+				t.Fatalf("expected 2 tracked files, got %v", files)
+			}
+
+			installed := make([]string, 0)
+
+			for _, file := range files {
+				if !strings.HasPrefix(file, layout.Directory+"/provider-ca-") || !strings.HasSuffix(file, layout.Extension) {
+					t.Errorf("unexpected file path %s", file)
+				}
+
+				content, err := os.ReadFile(filepath.Join(source, file))
+				if err != nil {
+					t.Fatalf("failed to read %s: %v", file, err)
+				}
+
+				installed = append(installed, string(content))
+			}
+
+			for _, ca := range []string{rootCA, intermediateCA} {
+				found := false
+
+				for _, content := range installed {
+					if content == ca {
+						found = true
+					}
+				}
+
+				if !found {
+					t.Errorf("CA certificate was not installed")
+				}
+			}
+		})
+	}
+}
+
+func TestInstallTrustStoreReplacesTrackedFiles(t *testing.T) {
+	layout := certificates.TrustStoreLayoutDebian
+	ca, _ := generateTestCA(t)
+	stale := layout.Directory + "/provider-ca-0011223344556677.crt"
+
+	stateIn := trustStoreState(layout, t.TempDir(), goopstest.StoredState{
+		trustStoreStateKey: `{"files":["` + stale + `"]}`,
+	})
+	recorder := &execRecorder{containers: stateIn.Containers}
+
+	ctx := goopstest.NewContext(
+		recorder.run(InstallTrustStoreExampleUse(layout, []string{ca})),
+	)
+
+	stateOut := ctx.Run("start", stateIn)
+
+	if ctx.CharmErr != nil {
+		t.Fatalf("charm error: %v", ctx.CharmErr)
+	}
+
+	assertCommands(t, recorder, []string{"rm", "-f", "--", stale}, layout.UpdateCommand)
+
+	files := trackedTrustStoreFiles(t, stateOut)
+	if len(files) != 1 || files[0] == stale {
+		t.Fatalf("expected the stale file to be replaced, got %v", files)
+	}
+}
+
+func TestInstallTrustStoreInvalidCertificate(t *testing.T) {
+	layout := certificates.TrustStoreLayoutDebian
+
+	ctx := goopstest.NewContext(
+		InstallTrustStoreExampleUse(layout, []string{"not a certificate"}),
+	)
+
+	stateOut := ctx.Run("start", trustStoreState(layout, t.TempDir(), nil))
+
+	if ctx.CharmErr == nil {
+		t.Fatalf("expected charm error for invalid CA certificate")
+	}
+
+	if _, ok := stateOut.StoredState[trustStoreStateKey]; ok {
+		t.Errorf("expected no trust store state to be stored")
+	}
+}
+
+func TestRemoveTrustStore(t *testing.T) {
+	layout := certificates.TrustStoreLayoutDebian
+	installed := layout.Directory + "/provider-ca-0011223344556677.crt"
+
+	stateIn := trustStoreState(layout, t.TempDir(), goopstest.StoredState{
+		trustStoreStateKey: `{"files":["` + installed + `"]}`,
+	})
+	recorder := &execRecorder{containers: stateIn.Containers}
+
+	ctx := goopstest.NewContext(
+		recorder.run(RemoveTrustStoreExampleUse),
+	)
+
+	stateOut := ctx.Run("certificates-relation-broken", stateIn)
+
+	if ctx.CharmErr != nil {
+		t.Fatalf("charm error: %v", ctx.CharmErr)
+	}
+
+	assertCommands(t, recorder, []string{"rm", "-f", "--", installed}, layout.UpdateCommand)
+
+	files := trackedTrustStoreFiles(t, stateOut)
+	if len(files) != 0 {
+		t.Fatalf("expected no tracked files, got %v", files)
+	}
+}
+
+func TestRemoveTrustStoreNothingInstalled(t *testing.T) {
+	ctx := goopstest.NewContext(
+		RemoveTrustStoreExampleUse,
+	)
+
+	_ = ctx.Run("certificates-relation-broken", trustStoreState(certificates.TrustStoreLayoutDebian, t.TempDir(), nil))
+
+	if ctx.CharmErr == nil {
+		t.Fatalf("expected charm error since nothing changed")
+	}
+}
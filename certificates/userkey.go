@@ -0,0 +1,62 @@
+package certificates
+
+import (
+	"crypto/rsa"
+	"errors"
+	"fmt"
+
+	"github.com/gruyaume/goops"
+)
+
+const minimumRSAKeySize = 2048
+
+var (
+	// ErrPrivateKeySecretNotFound is returned when the user secret holding
+	// the private key cannot be read, for example because it was not granted
+	// to the application.
+	ErrPrivateKeySecretNotFound = errors.New("private key secret not found")
+	// ErrInvalidPrivateKey is returned when the user secret does not hold a
+	// usable private key.
+	ErrInvalidPrivateKey = errors.New("invalid private key")
+)
+
+// getUserPrivateKey returns the private key of the user secret set in
+// PrivateKeySecretID, once it has been validated. The latest revision of the
+// secret is read, so replacing the key in the secret leads Request to publish
+// new certificate signing requests.
+func (i *IntegrationRequirer) getUserPrivateKey() (string, error) {
+	secret, err := goops.GetSecretByID(i.PrivateKeySecretID, false, true)
+	if err != nil {
+		return "", fmt.Errorf("%w: %s: %v", ErrPrivateKeySecretNotFound, i.PrivateKeySecretID, err)
+	}
+
+	privateKey := secret["private-key"]
+	if privateKey == "" {
+		return "", fmt.Errorf("%w: secret %s has no private-key field", ErrInvalidPrivateKey, i.PrivateKeySecretID)
+	}
+
+	err = validatePrivateKey(privateKey)
+	if err != nil {
+		return "", fmt.Errorf("%w: secret %s: %v", ErrInvalidPrivateKey, i.PrivateKeySecretID, err)
+	}
+
+	return privateKey, nil
+}
+
+func validatePrivateKey(privateKeyPEM string) error {
+	key, err := parsePrivateKeyPEM(privateKeyPEM)
+	if err != nil {
+		return err
+	}
+
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil
+	}
+
+	if rsaKey.N.BitLen() < minimumRSAKeySize {
+		return fmt.Errorf("RSA key size %d is below %d bits", rsaKey.N.BitLen(), minimumRSAKeySize)
+	}
+
+	return rsaKey.Validate()
+}
@@ -0,0 +1,203 @@
+package certificates_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/gruyaume/charm-libraries/certificates"
+	"github.com/gruyaume/goops/goopstest"
+)
+
+func newUserKeyRequirer() *certificates.IntegrationRequirer {
+	return &certificates.IntegrationRequirer{
+		RelationName:       "certificates",
+		PrivateKeySecretID: "secret:user-private-key",
+		CertificateRequests: []certificates.CertificateRequestAttributes{
+			{
+				Name:       "server",
+				CommonName: "server.example.com",
+				SansDNS:    []string{"server.example.com"},
+			},
+		},
+	}
+}
+
+func UserPrivateKeyExampleUse() error {
+	err := newUserKeyRequirer().Request()
+	if err != nil {
+		return fmt.Errorf("failed to request certificate: %w", err)
+	}
+
+	return nil
+}
+
+func userKeyState(privateKeyPEM string, relationData goopstest.DataBag) goopstest.State {
+	return goopstest.State{
+		Relations: []goopstest.Relation{
+			{
+				Endpoint:      "certificates",
+				LocalUnitData: relationData,
+			},
+		},
+		Secrets: []goopstest.Secret{
+			{
+				ID:      "secret:user-private-key",
+				Owner:   "user",
+				Content: map[string]string{"private-key": privateKeyPEM},
+			},
+		},
+	}
+}
+
+func requestedPublicKey(t *testing.T, relationData string) any {
+	t.Helper()
+
+	var csrData []*RequirerRelationData
+
+	if err := json.Unmarshal([]byte(relationData), &csrData); err != nil {
+		t.Fatalf("failed to unmarshal relation data: %v", err)
+	}
+
+	if len(csrData) != 1 {
+		t.Fatalf("expected 1 certificate signing request, got %d", len(csrData))
+	}
+
+	block, _ := pem.Decode([]byte(csrData[0].CertificateSigningRequest))
+
+	csr, err := parseCSRBlock(block)
+	if err != nil {
+		t.Fatalf("failed to parse certificate signing request: %v", err)
+	}
+
+	return csr.PublicKey
+}
+
+func TestRequestWithUserPrivateKey(t *testing.T) {
+	ctx := goopstest.NewContext(
+		UserPrivateKeyExampleUse,
+	)
+
+	privateKeyPEM, err := certificates.GeneratePrivateKey(certificates.KeyAlgorithmECDSAP256)
+	if err != nil {
+		t.Fatalf("failed to generate private key: %v", err)
+	}
+
+	stateOut := ctx.Run("config-changed", userKeyState(privateKeyPEM, nil))
+
+	if ctx.CharmErr != nil {
+		t.Fatalf("charm error: %v", ctx.CharmErr)
+	}
+
+	if len(stateOut.Secrets) != 1 {
+		t.Fatalf("expected no private key secret to be generated, got %d secrets", len(stateOut.Secrets))
+	}
+
+	block, _ := pem.Decode([]byte(privateKeyPEM))
+
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		t.Fatalf("failed to parse private key: %v", err)
+	}
+
+	publicKey := requestedPublicKey(t, stateOut.Relations[0].LocalUnitData["certificate_signing_requests"])
+
+	if !key.(*ecdsa.PrivateKey).PublicKey.Equal(publicKey) {
+		t.Fatal("expected the certificate signing request to be signed with the user private key")
+	}
+}
+
+func TestRequestWithChangedUserPrivateKey(t *testing.T) {
+	ctx := goopstest.NewContext(
+		UserPrivateKeyExampleUse,
+	)
+
+	oldPrivateKey, _ := generatePrivateKeyPEM(t)
+	oldCSR := generateCSRForKey(t, oldPrivateKey, "server.example.com")
+
+	csrs, err := json.Marshal([]map[string]string{
+		{"certificate_signing_request": oldCSR, "ca": "false"},
+	})
+	if err != nil {
+		t.Fatalf("failed to marshal certificate signing requests: %v", err)
+	}
+
+	_, privateKeyPEM := generatePrivateKeyPEM(t)
+
+	stateOut := ctx.Run("secret-changed", userKeyState(privateKeyPEM, goopstest.DataBag{
+		"certificate_signing_requests": string(csrs),
+	}))
+
+	if ctx.CharmErr != nil {
+		t.Fatalf("charm error: %v", ctx.CharmErr)
+	}
+
+	commonNames := parseRequestedCommonNames(t, stateOut.Relations[0].LocalUnitData["certificate_signing_requests"])
+
+	if commonNames["server.example.com"] == oldCSR {
+		t.Fatal("expected a new certificate signing request for the new private key")
+	}
+}
+
+func TestRequestWithUserPrivateKeyErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		secrets  []goopstest.Secret
+		expected error
+	}{
+		{
+			name:     "missing secret",
+			secrets:  nil,
+			expected: certificates.ErrPrivateKeySecretNotFound,
+		},
+		{
+			name: "malformed private key",
+			secrets: []goopstest.Secret{
+				{
+					ID:      "secret:user-private-key",
+					Owner:   "user",
+					Content: map[string]string{"private-key": "not a private key"},
+				},
+			},
+			expected: certificates.ErrInvalidPrivateKey,
+		},
+		{
+			name: "missing private key field",
+			secrets: []goopstest.Secret{
+				{
+					ID:      "secret:user-private-key",
+					Owner:   "user",
+					Content: map[string]string{"key": "value"},
+				},
+			},
+			expected: certificates.ErrInvalidPrivateKey,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := goopstest.NewContext(
+				UserPrivateKeyExampleUse,
+			)
+
+			stateIn := goopstest.State{
+				Relations: []goopstest.Relation{
+					{
+						Endpoint: "certificates",
+					},
+				},
+				Secrets: tt.secrets,
+			}
+
+			_ = ctx.Run("config-changed", stateIn)
+
+			if !errors.Is(ctx.CharmErr, tt.expected) {
+				t.Fatalf("expected error %v, got %v", tt.expected, ctx.CharmErr)
+			}
+		})
+	}
+}
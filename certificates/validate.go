@@ -0,0 +1,115 @@
+package certificates
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gruyaume/goops"
+)
+
+// ErrNoValidCertificate is returned when the provider has not issued a
+// usable certificate for the certificate request.
+var ErrNoValidCertificate = errors.New("no valid certificate")
+
+// CertificateDiagnostic reports a certificate issued for one of our
+// certificate signing requests that was rejected, and why.
+type CertificateDiagnostic struct {
+	CertificateSigningRequest string
+	Certificate               string
+	Err                       error
+}
+
+// GetValidatedCertificate returns the certificate issued for the named
+// certificate request, once verified. Only entries for a certificate signing
+// request of ours, signed by our private key, are considered. A certificate
+// must not be revoked by the provider, must carry the public key of the
+// request, chain to the provided CA through the chain, be currently valid and
+// cover the requested SANs. The entries that fail are returned as diagnostics.
+func (i *IntegrationRequirer) GetValidatedCertificate(name string) (*ProviderCertificate, []CertificateDiagnostic, error) {
+	certificateRequest, err := i.getCertificateRequest(name)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	privateKey, err := i.GetPrivateKey()
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not get private key: %w", err)
+	}
+
+	providerCertificates, err := i.GetProviderCertificate()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	privateKeys := []string{privateKey}
+
+	// While the private key is rotated, the certificate issued for the
+	// previous key is still the one to use.
+	previousPrivateKey, err := i.getPreviousPrivateKey()
+	if err == nil && previousPrivateKey != "" {
+		privateKeys = append(privateKeys, previousPrivateKey)
+	}
+
+	var diagnostics []CertificateDiagnostic
+
+	for _, key := range privateKeys {
+		providerCertificate, keyDiagnostics := findValidCertificate(providerCertificates, certificateRequest, key)
+		diagnostics = append(diagnostics, keyDiagnostics...)
+
+		if providerCertificate != nil {
+			return providerCertificate, diagnostics, nil
+		}
+	}
+
+	return nil, diagnostics, fmt.Errorf("%w assigned for %q", ErrNoValidCertificate, name)
+}
+
+// findValidCertificate returns the valid certificate issued for the
+// certificate request that expires last, with the reasons the others were
+// rejected.
+func findValidCertificate(providerCertificates []*ProviderCertificate, certificateRequest CertificateRequestAttributes, privateKey string) (*ProviderCertificate, []CertificateDiagnostic) {
+	var (
+		valid         *ProviderCertificate
+		validNotAfter time.Time
+		diagnostics   []CertificateDiagnostic
+	)
+
+	for _, providerCertificate := range providerCertificates {
+		if !certificateRequested(providerCertificate.CertificateSigningRequest, certificateRequest, privateKey) {
+			continue
+		}
+
+		err := ErrCertificateRevoked
+		if !providerCertificate.Revoked {
+			err = verifyRelationCertificate(&SetRelationCertificateOptions{
+				CA:                        providerCertificate.CA,
+				Chain:                     providerCertificate.Chain,
+				CertificateSigningRequest: providerCertificate.CertificateSigningRequest,
+				Certificate:               providerCertificate.Certificate,
+			})
+		}
+
+		if err != nil {
+			goops.LogWarningf("Rejected certificate for %s: %v", certificateRequest.CommonName, err)
+
+			diagnostics = append(diagnostics, CertificateDiagnostic{
+				CertificateSigningRequest: providerCertificate.CertificateSigningRequest,
+				Certificate:               providerCertificate.Certificate,
+				Err:                       err,
+			})
+
+			continue
+		}
+
+		// The certificate parsed during verification.
+		cert, _ := parseCertificatePEM(providerCertificate.Certificate)
+
+		if valid == nil || cert.NotAfter.After(validNotAfter) {
+			valid = providerCertificate
+			validNotAfter = cert.NotAfter
+		}
+	}
+
+	return valid, diagnostics
+}
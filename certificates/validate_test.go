@@ -0,0 +1,201 @@
+package certificates_test
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/gruyaume/charm-libraries/certificates"
+	"github.com/gruyaume/goops/goopstest"
+)
+
+func GetValidatedCertificateExampleUse(expectedCertificate string, expectedDiagnostics int) error {
+	integration := &certificates.IntegrationRequirer{
+		RelationName: "certificates",
+		CertificateRequests: []certificates.CertificateRequestAttributes{
+			{
+				Name:       "server",
+				CommonName: "server.example.com",
+				SansDNS:    []string{"server.example.com"},
+			},
+		},
+	}
+
+	providerCertificate, diagnostics, err := integration.GetValidatedCertificate("server")
+
+	if len(diagnostics) != expectedDiagnostics {
+		return fmt.Errorf("expected %d diagnostics, got %d", expectedDiagnostics, len(diagnostics))
+	}
+
+	for _, diagnostic := range diagnostics {
+		if !errors.Is(diagnostic.Err, certificates.ErrChainVerification) {
+			return fmt.Errorf("expected a chain verification diagnostic, got %v", diagnostic.Err)
+		}
+	}
+
+	if expectedCertificate == "" {
+		if !errors.Is(err, certificates.ErrNoValidCertificate) {
+			return fmt.Errorf("expected no valid certificate, got %v", err)
+		}
+
+		return nil
+	}
+
+	if err != nil {
+		return fmt.Errorf("failed to get validated certificate: %w", err)
+	}
+
+	if providerCertificate.Certificate != expectedCertificate {
+		return fmt.Errorf("expected the valid certificate to be returned")
+	}
+
+	return nil
+}
+
+func validatedCertificateState(t *testing.T, privateKeyPEM string, csrs []string, providerCertificates []certificates.ProviderCertificate) goopstest.State {
+	t.Helper()
+
+	csrData := make([]map[string]string, 0, len(csrs))
+	for _, csr := range csrs {
+		csrData = append(csrData, map[string]string{"certificate_signing_request": csr, "ca": "false"})
+	}
+
+	csrJSON, err := json.Marshal(csrData)
+	if err != nil {
+		t.Fatalf("failed to marshal certificate signing requests: %v", err)
+	}
+
+	providerJSON, err := json.Marshal(providerCertificates)
+	if err != nil {
+		t.Fatalf("failed to marshal provider certificates: %v", err)
+	}
+
+	return goopstest.State{
+		Relations: []goopstest.Relation{
+			{
+				Endpoint:      "certificates",
+				RemoteAppName: "provider",
+				LocalUnitData: goopstest.DataBag{
+					"certificate_signing_requests": string(csrJSON),
+				},
+				RemoteAppData: goopstest.DataBag{
+					"certificates": string(providerJSON),
+				},
+				RemoteUnitsData: map[goopstest.UnitID]goopstest.DataBag{
+					"provider/0": {},
+				},
+			},
+		},
+		Secrets: []goopstest.Secret{
+			{
+				ID:      "private-key-secret",
+				Label:   certificates.PrivateKeySecretLabel,
+				Owner:   "unit",
+				Content: map[string]string{"private-key": privateKeyPEM},
+			},
+		},
+	}
+}
+
+// signWithNewCA signs the certificate signing request with a new CA and
+// returns the certificate and the CA.
+func signWithNewCA(t *testing.T, csrPEM string) (string, string) {
+	t.Helper()
+
+	caPEM, caKeyPEM := generateTestCA(t)
+
+	return signTestCSR(t, csrPEM, caPEM, caKeyPEM), caPEM
+}
+
+func TestGetValidatedCertificate(t *testing.T) {
+	privateKey, privateKeyPEM := generatePrivateKeyPEM(t)
+	csrPEM := generateCSRForKey(t, privateKey, "server.example.com")
+
+	certPEM, caPEM := signWithNewCA(t, csrPEM)
+
+	// Signed by another CA than the one it claims.
+	untrustedPEM, _ := signWithNewCA(t, csrPEM)
+
+	// Issued for another unit.
+	otherUnit := issueTestCertificate(t, "certificates:0", "server.example.com")
+
+	providerCertificates := []certificates.ProviderCertificate{
+		{CA: caPEM, Chain: []string{certPEM, caPEM}, CertificateSigningRequest: csrPEM, Certificate: certPEM},
+		{CA: caPEM, Chain: []string{untrustedPEM, caPEM}, CertificateSigningRequest: csrPEM, Certificate: untrustedPEM},
+		{CA: otherUnit.CA, Chain: otherUnit.Chain, CertificateSigningRequest: otherUnit.CertificateSigningRequest, Certificate: otherUnit.Certificate},
+	}
+
+	ctx := goopstest.NewContext(
+		func() error { return GetValidatedCertificateExampleUse(certPEM, 1) },
+	)
+
+	_ = ctx.Run("start", validatedCertificateState(t, privateKeyPEM, []string{csrPEM}, providerCertificates))
+
+	if ctx.CharmErr != nil {
+		t.Fatalf("charm error: %v", ctx.CharmErr)
+	}
+}
+
+func TestGetValidatedCertificateRejectsInvalid(t *testing.T) {
+	privateKey, privateKeyPEM := generatePrivateKeyPEM(t)
+	csrPEM := generateCSRForKey(t, privateKey, "server.example.com")
+
+	certPEM, _ := signWithNewCA(t, csrPEM)
+	_, claimedCA := signWithNewCA(t, csrPEM)
+
+	providerCertificates := []certificates.ProviderCertificate{
+		{CA: claimedCA, Chain: []string{certPEM, claimedCA}, CertificateSigningRequest: csrPEM, Certificate: certPEM},
+	}
+
+	ctx := goopstest.NewContext(
+		func() error { return GetValidatedCertificateExampleUse("", 1) },
+	)
+
+	_ = ctx.Run("start", validatedCertificateState(t, privateKeyPEM, []string{csrPEM}, providerCertificates))
+
+	if ctx.CharmErr != nil {
+		t.Fatalf("charm error: %v", ctx.CharmErr)
+	}
+}
+
+func TestGetValidatedCertificateSkipsRevoked(t *testing.T) {
+	privateKey, privateKeyPEM := generatePrivateKeyPEM(t)
+	csrPEM := generateCSRForKey(t, privateKey, "server.example.com")
+
+	certPEM, caPEM := signWithNewCA(t, csrPEM)
+
+	providerCertificates := []certificates.ProviderCertificate{
+		{CA: caPEM, Chain: []string{certPEM, caPEM}, CertificateSigningRequest: csrPEM, Certificate: certPEM, Revoked: true},
+	}
+
+	ctx := goopstest.NewContext(func() error {
+		integration := &certificates.IntegrationRequirer{
+			RelationName: "certificates",
+			CertificateRequests: []certificates.CertificateRequestAttributes{
+				{
+					Name:       "server",
+					CommonName: "server.example.com",
+					SansDNS:    []string{"server.example.com"},
+				},
+			},
+		}
+
+		_, diagnostics, err := integration.GetValidatedCertificate("server")
+		if !errors.Is(err, certificates.ErrNoValidCertificate) {
+			return fmt.Errorf("expected no valid certificate, got %v", err)
+		}
+
+		if len(diagnostics) != 1 || !errors.Is(diagnostics[0].Err, certificates.ErrCertificateRevoked) {
+			return fmt.Errorf("expected a revoked certificate diagnostic, got %v", diagnostics)
+		}
+
+		return nil
+	})
+
+	_ = ctx.Run("start", validatedCertificateState(t, privateKeyPEM, []string{csrPEM}, providerCertificates))
+
+	if ctx.CharmErr != nil {
+		t.Fatalf("charm error: %v", ctx.CharmErr)
+	}
+}
@@ -0,0 +1,151 @@
+package certificates
+
+import (
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"time"
+)
+
+// clockSkew is how far in the future a certificate may start to be valid, to
+// allow for clock differences between the signer and this unit.
+const clockSkew = 5 * time.Minute
+
+var (
+	// ErrInvalidCertificate is returned when the certificate, the CA or an
+	// element of the chain cannot be parsed.
+	ErrInvalidCertificate = errors.New("invalid certificate")
+	// ErrPublicKeyMismatch is returned when the certificate does not carry
+	// the public key of the certificate signing request.
+	ErrPublicKeyMismatch = errors.New("certificate public key does not match the certificate signing request")
+	// ErrChainVerification is returned when the certificate does not chain
+	// to the CA through the chain.
+	ErrChainVerification = errors.New("certificate does not chain to the CA")
+	// ErrSANsMismatch is returned when the certificate lacks subject
+	// alternative names requested in the certificate signing request.
+	ErrSANsMismatch = errors.New("certificate does not cover the requested subject alternative names")
+	// ErrCertificateExpired is returned when the certificate is expired.
+	ErrCertificateExpired = errors.New("certificate is expired")
+	// ErrCertificateNotYetValid is returned when the validity of the
+	// certificate starts in the future.
+	ErrCertificateNotYetValid = errors.New("certificate is not yet valid")
+	// ErrCertificateRevoked is returned when the provider marked the
+	// certificate as revoked.
+	ErrCertificateRevoked = errors.New("certificate is revoked")
+)
+
+// verifyRelationCertificate checks that the certificate answers the
+// certificate signing request and is usable now.
+func verifyRelationCertificate(opts *SetRelationCertificateOptions) error {
+	csr, err := parseCertificateSigningRequestPEM(opts.CertificateSigningRequest)
+	if err != nil {
+		return fmt.Errorf("could not parse certificate signing request: %w", err)
+	}
+
+	cert, err := parseCertificatePEM(opts.Certificate)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidCertificate, err)
+	}
+
+	if !publicKeysEqual(cert.PublicKey, csr.PublicKey) {
+		return ErrPublicKeyMismatch
+	}
+
+	now := time.Now()
+
+	if now.After(cert.NotAfter) {
+		return fmt.Errorf("%w: expired at %s", ErrCertificateExpired, cert.NotAfter.Format(time.RFC3339))
+	}
+
+	if cert.NotBefore.After(now.Add(clockSkew)) {
+		return fmt.Errorf("%w: valid from %s", ErrCertificateNotYetValid, cert.NotBefore.Format(time.RFC3339))
+	}
+
+	err = verifyCertificateSANs(cert, csr)
+	if err != nil {
+		return err
+	}
+
+	return verifyCertificateChain(cert, opts.CA, opts.Chain, now)
+}
+
+func verifyCertificateSANs(cert *x509.Certificate, csr *x509.CertificateRequest) error {
+	for _, name := range csr.DNSNames {
+		if !slices.Contains(cert.DNSNames, name) {
+			return fmt.Errorf("%w: DNS name %s is missing", ErrSANsMismatch, name)
+		}
+	}
+
+	for _, ip := range csr.IPAddresses {
+		if !slices.ContainsFunc(cert.IPAddresses, ip.Equal) {
+			return fmt.Errorf("%w: IP address %s is missing", ErrSANsMismatch, ip)
+		}
+	}
+
+	for _, email := range csr.EmailAddresses {
+		if !slices.Contains(cert.EmailAddresses, email) {
+			return fmt.Errorf("%w: email address %s is missing", ErrSANsMismatch, email)
+		}
+	}
+
+	for _, uri := range csr.URIs {
+		if !slices.ContainsFunc(cert.URIs, func(certURI *url.URL) bool { return certURI.String() == uri.String() }) {
+			return fmt.Errorf("%w: URI %s is missing", ErrSANsMismatch, uri)
+		}
+	}
+
+	requestedOIDs, err := parseSubjectAltNameOIDs(csr.Extensions)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrSANsMismatch, err)
+	}
+
+	certOIDs, err := parseSubjectAltNameOIDs(cert.Extensions)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidCertificate, err)
+	}
+
+	for _, oid := range requestedOIDs {
+		if !slices.Contains(certOIDs, oid) {
+			return fmt.Errorf("%w: registered ID %s is missing", ErrSANsMismatch, oid)
+		}
+	}
+
+	return nil
+}
+
+// verifyCertificateChain checks that the certificate chains to the CA, using
+// the elements of the chain as intermediates.
+func verifyCertificateChain(cert *x509.Certificate, caPEM string, chain []string, now time.Time) error {
+	ca, err := parseCertificatePEM(caPEM)
+	if err != nil {
+		return fmt.Errorf("%w: CA: %v", ErrInvalidCertificate, err)
+	}
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca)
+
+	intermediates := x509.NewCertPool()
+
+	for i, certificatePEM := range chain {
+		chainCert, err := parseCertificatePEM(certificatePEM)
+		if err != nil {
+			return fmt.Errorf("%w: chain element %d: %v", ErrInvalidCertificate, i, err)
+		}
+
+		intermediates.AddCert(chainCert)
+	}
+
+	_, err = cert.Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		CurrentTime:   now,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	})
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrChainVerification, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,81 @@
+package certificates_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/gruyaume/charm-libraries/certificates"
+	"github.com/gruyaume/goops/goopstest"
+)
+
+func TestSetRelationCertificateVerification(t *testing.T) {
+	caPEM, caKeyPEM := generateTestCA(t)
+
+	privateKey, _ := generatePrivateKeyPEM(t)
+	csrPEM := generateCSRForKey(t, privateKey, "a.example.com")
+	otherNameCSRPEM := generateCSRForKey(t, privateKey, "b.example.com")
+
+	sign := func(csr string, validity time.Duration) string {
+		certPEM, err := certificates.SignCertificateSigningRequest(csr, caPEM, caKeyPEM, &certificates.SignCertificateSigningRequestOpts{
+			ValidityDuration: validity,
+		})
+		if err != nil {
+			t.Fatalf("failed to sign certificate signing request: %v", err)
+		}
+
+		return certPEM
+	}
+
+	otherKey, _ := generatePrivateKeyPEM(t)
+	otherKeyCSRPEM := generateCSRForKey(t, otherKey, "a.example.com")
+	untrusted := issueTestCertificate(t, "certificates:0", "a.example.com")
+
+	tests := []struct {
+		name        string
+		certificate string
+		csr         string
+		expected    error
+	}{
+		{"public key mismatch", sign(otherKeyCSRPEM, time.Hour), csrPEM, certificates.ErrPublicKeyMismatch},
+		{"missing SAN", sign(otherNameCSRPEM, time.Hour), csrPEM, certificates.ErrSANsMismatch},
+		{"expired", sign(csrPEM, -time.Hour), csrPEM, certificates.ErrCertificateExpired},
+		{"untrusted CA", untrusted.Certificate, untrusted.CertificateSigningRequest, certificates.ErrChainVerification},
+		{"invalid certificate", "not a certificate", csrPEM, certificates.ErrInvalidCertificate},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			opts := &certificates.SetRelationCertificateOptions{
+				RelationID:                "certificates:0",
+				CA:                        caPEM,
+				Chain:                     []string{tc.certificate, caPEM},
+				CertificateSigningRequest: tc.csr,
+				Certificate:               tc.certificate,
+			}
+
+			ctx := goopstest.NewContext(
+				func() error { return SetRelationCertificateExampleUse(opts) },
+			)
+
+			stateIn := goopstest.State{
+				Leader: true,
+				Relations: []goopstest.Relation{
+					{
+						Endpoint: "certificates",
+					},
+				},
+			}
+
+			stateOut := ctx.Run("start", stateIn)
+
+			if !errors.Is(ctx.CharmErr, tc.expected) {
+				t.Fatalf("expected error %v, got %v", tc.expected, ctx.CharmErr)
+			}
+
+			if stateOut.Relations[0].LocalAppData["certificates"] != "" {
+				t.Fatalf("expected nothing to be published")
+			}
+		})
+	}
+}